@@ -11,20 +11,24 @@ func main() {
 
 	h := hc.NewHCSR04(4, 25)
 
-	myLcd, err := lcd.NewLCD4([]int{27, 22, 23, 24}, 17, 18)
+	myLcd, err := lcd.NewLCD4([]int{27, 22, 23, 24}, 17, 18, lcd.LCD16x2)
 
 	if err != nil {
 		panic(err.Error())
 	}
 
-	myLcd.Init()
-	myLcd.Cls()
+	if err = myLcd.Init(); err != nil {
+		panic(err.Error())
+	}
 
 	for true {
 		distance := h.MeasureDistance()
 		fmt.Println(distance)
-		myLcd.SetCursor(0, 0)
-		myLcd.Print(fmt.Sprintf("Distance: %5.2f", distance))
+		if err = myLcd.SetCursor(0, 0); err != nil {
+			fmt.Println(err)
+		} else if err = myLcd.Print(fmt.Sprintf("Distance: %5.2f", distance)); err != nil {
+			fmt.Println(err)
+		}
 		time.Sleep(time.Duration(1) * time.Second)
 	}
 
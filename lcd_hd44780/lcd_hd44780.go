@@ -0,0 +1,308 @@
+package lcd_hd44780
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const LineTwo = 0x40 // start of line 2
+
+// instructions
+const (
+	cmdClear       = 0x01
+	cmdHome        = 0x02
+	cmdEntryMode   = 0x04
+	cmdDisplay     = 0x08
+	cmdShift       = 0x10
+	cmdFunctionSet = 0x20
+	cmdSetCGRAM    = 0x40
+	cmdSetDDRAM    = 0x80
+)
+
+// instruction flags
+const (
+	entryIncrement = 0x02 // cmdEntryMode: move the cursor right
+	entryShift     = 0x01 // cmdEntryMode: shift the display instead
+
+	displayOn = 0x04 // cmdDisplay
+	cursorOn  = 0x02 // cmdDisplay: underline cursor
+	blinkOn   = 0x01 // cmdDisplay: blinking block cursor
+
+	shiftDisplay = 0x08 // cmdShift: the display rather than the cursor
+	shiftRight   = 0x04 // cmdShift
+
+	functionEightBit = 0x10 // cmdFunctionSet: 8 bit bus
+	functionTwoLines = 0x08 // cmdFunctionSet: 2 lines
+	functionFont5x10 = 0x04 // cmdFunctionSet: 5x10 font, 1 line only
+)
+
+type PiLCD interface {
+	Init() error
+
+	Cls() error
+
+	Print(data string) error
+
+	WriteChar(data uint8) error
+
+	SetCursor(line uint8, column uint8) error
+
+	DefineChar(slot uint8, g Glyph) error
+
+	RegisterGlyph(r rune, g Glyph)
+
+	Display(on bool) error
+
+	Cursor(on bool) error
+
+	Blink(on bool) error
+
+	Home() error
+
+	CursorLeft() error
+
+	CursorRight() error
+
+	ScrollLeft() error
+
+	ScrollRight() error
+
+	EntryMode(increment bool, autoscroll bool) error
+
+	Geometry() Geometry
+
+	SetCharset(c *Charset)
+}
+
+// bus moves the bytes to the controller
+type bus interface {
+	// setup configures the pins
+	setup() error
+	// reset runs the initialization by instruction from the datasheet, which
+	// leaves the controller in the width of the bus whatever state it was in
+	reset() error
+	// write sends a byte to the data register if rs is set, to the
+	// instruction register otherwise
+	write(rs bool, data uint8) error
+	eightBit() bool
+	// readable tells whether RW is wired, read works only then
+	readable() bool
+	// read returns the busy flag and the address counter if rs is clear, the
+	// data at the address counter otherwise
+	read(rs bool) (uint8, error)
+}
+
+const busyFlag = 0x80
+
+// busyTimeout is much longer than the slowest instruction, a display that
+// stays busy that long doesn't have RW wired
+const busyTimeout = 20 * time.Millisecond
+
+// execution times from the datasheet, used when the busy flag can't be read
+const (
+	execTime  = 50 * time.Microsecond
+	clearTime = 2 * time.Millisecond
+)
+
+// hd44780 is the part of the driver common to every bus
+type hd44780 struct {
+	bus      bus
+	geometry Geometry
+	addr     uint8 // DDRAM address of the cursor
+	cgram    cgram
+	charset  *Charset
+	polling  bool  // the busy flag is read instead of waiting
+	control  uint8 // cmdDisplay flags
+	entry    uint8 // cmdEntryMode flags
+}
+
+func (h *hd44780) configure(b bus, g Geometry) (err error) {
+	if err = g.validate(); err != nil {
+		return
+	}
+	h.bus = b
+	h.geometry = g
+	h.entry = entryIncrement
+	h.control = displayOn
+	return
+}
+
+// wait returns when the controller is ready for the next transfer
+func (h *hd44780) wait(delay time.Duration) (err error) {
+	if !h.polling {
+		time.Sleep(delay)
+		return
+	}
+	for start := time.Now(); time.Since(start) < busyTimeout; {
+		status, err := h.bus.read(false)
+		if err != nil || status&busyFlag == 0 {
+			return err
+		}
+	}
+	h.polling = false
+	return
+}
+
+func (h *hd44780) Geometry() Geometry {
+	return h.geometry
+}
+
+func (h *hd44780) command(data uint8, delay time.Duration) (err error) {
+	if err = h.bus.write(false, data); err != nil {
+		return
+	}
+	err = h.wait(delay)
+	return
+}
+
+func (h *hd44780) instruction(data uint8) error {
+	return h.command(data, execTime)
+}
+
+func (h *hd44780) data(data uint8) (err error) {
+	if err = h.bus.write(true, data); err != nil {
+		return
+	}
+	err = h.wait(execTime)
+	return
+}
+
+func (h *hd44780) Init() (err error) {
+
+	if err = h.bus.setup(); err != nil {
+		return
+	}
+
+	delayMs(15)
+
+	if err = h.bus.reset(); err != nil {
+		return
+	}
+
+	// the busy flag works from the function set on
+	h.polling = h.bus.readable()
+
+	function := uint8(cmdFunctionSet)
+	if h.bus.eightBit() {
+		function |= functionEightBit
+	}
+	if h.geometry.twoLines() {
+		function |= functionTwoLines
+	}
+	if h.geometry.Font5x10 {
+		function |= functionFont5x10
+	}
+	if err = h.instruction(function); err != nil {
+		return
+	}
+
+	// disable display
+	if err = h.instruction(cmdDisplay); err != nil {
+		return
+	}
+
+	if err = h.Cls(); err != nil {
+		return
+	}
+
+	// cursor shift right, no display move unless EntryMode said otherwise
+	if err = h.instruction(cmdEntryMode | h.entry); err != nil {
+		return
+	}
+
+	// enable display, no cursor unless Cursor or Blink said otherwise
+	err = h.instruction(cmdDisplay | h.control)
+	return
+}
+
+func (h *hd44780) Cls() (err error) {
+	if err = h.command(cmdClear, clearTime); err != nil {
+		return
+	}
+	h.addr = 0
+	return
+}
+
+func (h *hd44780) checkPosition(line uint8, column uint8) (err error) {
+	if line >= h.geometry.Rows || column >= h.geometry.Columns {
+		err = errors.New(fmt.Sprintf("%d:%d is outside of the %dx%d display", line, column, h.geometry.Columns, h.geometry.Rows))
+	}
+	return
+}
+
+// SetCursor moves the cursor to the row and the column, both counted from 0
+func (h *hd44780) SetCursor(line uint8, column uint8) (err error) {
+	if err = h.checkPosition(line, column); err != nil {
+		return
+	}
+	addr := h.geometry.rowAddress(line) + column
+	if err = h.instruction(cmdSetDDRAM | addr); err != nil {
+		return
+	}
+	h.addr = addr
+	return
+}
+
+func (h *hd44780) WriteChar(data uint8) (err error) {
+	if err = h.data(data); err != nil {
+		return
+	}
+	if h.entry&entryIncrement != 0 {
+		h.addr = h.geometry.next(h.addr)
+	} else {
+		h.addr = h.geometry.prev(h.addr)
+	}
+	return
+}
+
+var errNotReadable = errors.New("RW is not wired, the display can't be read")
+
+// ReadAddress reads the address counter: the DDRAM address of the cursor,
+// or the CGRAM address right after DefineChar
+func (h *hd44780) ReadAddress() (addr uint8, err error) {
+	if !h.bus.readable() {
+		err = errNotReadable
+		return
+	}
+	addr, err = h.bus.read(false)
+	addr &^= busyFlag
+	return
+}
+
+// ReadDDRAM reads n characters of the display memory starting with the
+// row and the column. The cursor stays where it was.
+func (h *hd44780) ReadDDRAM(line uint8, column uint8, n int) (data []byte, err error) {
+	if !h.bus.readable() {
+		err = errNotReadable
+		return
+	}
+	if err = h.checkPosition(line, column); err != nil {
+		return
+	}
+	if err = h.instruction(cmdSetDDRAM | (h.geometry.rowAddress(line) + column)); err != nil {
+		return
+	}
+	for i := 0; i < n; i++ {
+		v, err := h.bus.read(true)
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, v)
+		if err = h.wait(execTime); err != nil {
+			return nil, err
+		}
+	}
+	err = h.instruction(cmdSetDDRAM | h.addr)
+	return
+}
+
+// =============================================== service methods ============================================
+
+func delayUs(ms int) {
+	time.Sleep(time.Duration(ms) * time.Microsecond)
+}
+
+func delayMs(ms int) {
+	time.Sleep(time.Duration(ms) * time.Millisecond)
+}
@@ -0,0 +1,26 @@
+package lcd_hd44780
+
+// PiLCD8 drives the display through 8 data pins, D0..D7, a byte per
+// transfer
+type PiLCD8 struct {
+	hd44780
+	parallel *parallelBus
+}
+
+func NewLCD8(data []int, rs int, e int, g Geometry) (pLcd PiLCD8, err error) {
+	b, err := openParallelBus(data, rs, e, 8)
+	if err != nil {
+		return
+	}
+	pLcd.parallel = b
+	err = pLcd.configure(b, g)
+	return
+}
+
+// UseRWPin tells the driver RW is wired to the pin (BCM numbering) instead of
+// the ground: the busy flag is polled rather than waiting the worst case time
+// of every instruction, and the display memory can be read back. Call it
+// before Init.
+func (r *PiLCD8) UseRWPin(rw int) error {
+	return r.parallel.useRW(rw)
+}
@@ -0,0 +1,120 @@
+package lcd_hd44780
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Glyph is a 5x8 custom character, a row per byte from the top, the lowest
+// 5 bits of a row from right to left
+type Glyph [8]uint8
+
+var (
+	GlyphBattery = Glyph{0x0E, 0x1B, 0x11, 0x1F, 0x1F, 0x1F, 0x1F, 0x1F}
+	GlyphWifi    = Glyph{0x00, 0x0E, 0x11, 0x04, 0x0A, 0x00, 0x04, 0x00}
+	GlyphLock    = Glyph{0x0E, 0x11, 0x11, 0x1F, 0x1B, 0x1B, 0x1F, 0x00}
+)
+
+// CGRAMSlots is the number of custom characters the controller holds,
+// character codes 0..7. With the 5x10 font only the first 4 are available,
+// as the even codes 0, 2, 4 and 6.
+const CGRAMSlots = 8
+
+type cgramSlot struct {
+	glyph  Glyph
+	loaded bool
+	used   uint64
+}
+
+// cgram tracks the content of the CGRAM, the least recently used slot is
+// reloaded when a glyph that is not there is printed
+type cgram struct {
+	glyphs map[rune]Glyph
+	slots  [CGRAMSlots]cgramSlot
+	tick   uint64
+}
+
+func (c *cgram) touch(slot uint8) {
+	c.tick++
+	c.slots[slot].used = c.tick
+}
+
+func (h *hd44780) slots() uint8 {
+	if h.geometry.Font5x10 {
+		return CGRAMSlots / 2
+	}
+	return CGRAMSlots
+}
+
+// DefineChar loads the glyph into the slot, the character code of the slot
+// is the slot number, twice the slot number with the 5x10 font, see
+// SlotCode. The 5x10 font gets the glyph on top of 3 blank rows.
+func (h *hd44780) DefineChar(slot uint8, g Glyph) (err error) {
+	if slot >= h.slots() {
+		err = errors.New(fmt.Sprintf("slot %d is out of range, %d slots", slot, h.slots()))
+		return
+	}
+	rows := g[:]
+	address := slot << 3
+	if h.geometry.Font5x10 {
+		// 16 bytes per character, the 11th row is the cursor line
+		address = slot << 4
+		rows = append(rows, 0, 0, 0)
+	}
+	// the slot content is unknown until the write completes
+	h.cgram.slots[slot] = cgramSlot{}
+	if err = h.instruction(cmdSetCGRAM | address); err != nil {
+		return
+	}
+	for _, row := range rows {
+		if err = h.data(row); err != nil {
+			return
+		}
+	}
+	// back to the display memory
+	if err = h.instruction(cmdSetDDRAM | h.addr); err != nil {
+		return
+	}
+	h.cgram.slots[slot] = cgramSlot{glyph: g, loaded: true}
+	h.cgram.touch(slot)
+	return
+}
+
+// SlotCode returns the character code that shows the slot. The 5x10 font
+// ignores the lowest bit of the code, slot s is code s<<1.
+func (h *hd44780) SlotCode(slot uint8) uint8 {
+	if h.geometry.Font5x10 {
+		return slot << 1
+	}
+	return slot
+}
+
+// RegisterGlyph makes Print show the glyph for the rune. Only 8 glyphs fit
+// into the CGRAM at the same time: printing another one reloads the least
+// recently printed slot, which changes the characters of that slot still on
+// the screen.
+func (h *hd44780) RegisterGlyph(r rune, g Glyph) {
+	if h.cgram.glyphs == nil {
+		h.cgram.glyphs = make(map[rune]Glyph)
+	}
+	h.cgram.glyphs[r] = g
+}
+
+// glyphCode returns the character code of the glyph, loading it if needed
+func (h *hd44780) glyphCode(g Glyph) (code uint8, err error) {
+	// slots never loaded have not been used either
+	victim := uint8(0)
+	for i, s := range h.cgram.slots[:h.slots()] {
+		slot := uint8(i)
+		if s.loaded && s.glyph == g {
+			h.cgram.touch(slot)
+			return h.SlotCode(slot), nil
+		}
+		if s.used < h.cgram.slots[victim].used {
+			victim = slot
+		}
+	}
+	err = h.DefineChar(victim, g)
+	code = h.SlotCode(victim)
+	return
+}
@@ -0,0 +1,152 @@
+package lcd_hd44780
+
+// Charset maps the runes to the character codes of a character ROM. Runes
+// the ROM lacks are drawn with a custom glyph if the charset has one, or
+// replaced with a look-alike.
+type Charset struct {
+	Name   string
+	codes  map[rune]uint8
+	glyphs map[rune]Glyph
+}
+
+func asciiCodes(except ...rune) map[rune]uint8 {
+	codes := make(map[rune]uint8)
+	for r := rune(0x20); r < 0x7F; r++ {
+		codes[r] = uint8(r)
+	}
+	for _, r := range except {
+		delete(codes, r)
+	}
+	return codes
+}
+
+// CharsetA00 is the Japanese ROM, the most common one: ASCII without the
+// backslash and the tilde, half width katakana and a few Greek letters and
+// symbols
+var CharsetA00 = func() *Charset {
+	c := &Charset{
+		Name:  "A00",
+		codes: asciiCodes('\\', '~'),
+		glyphs: map[rune]Glyph{
+			'\\': {0x00, 0x10, 0x08, 0x04, 0x02, 0x01, 0x00, 0x00},
+			'~':  {0x00, 0x00, 0x08, 0x15, 0x02, 0x00, 0x00, 0x00},
+			'€':  {0x06, 0x09, 0x1C, 0x08, 0x1C, 0x09, 0x06, 0x00},
+		},
+	}
+	// JIS X 0201 katakana
+	for r := rune(0xFF61); r <= 0xFF9F; r++ {
+		c.codes[r] = uint8(r - 0xFF61 + 0xA1)
+	}
+	for r, code := range map[rune]uint8{
+		'¥': 0x5C, '→': 0x7E, '←': 0x7F,
+		'°': 0xDF, 'α': 0xE0, 'ä': 0xE1, 'β': 0xE2, 'ß': 0xE2, 'ε': 0xE3, 'μ': 0xE4, 'µ': 0xE4,
+		'σ': 0xE5, 'ρ': 0xE6, '√': 0xE8, '¢': 0xEC, 'ñ': 0xEE, 'ö': 0xEF,
+		'θ': 0xF2, '∞': 0xF3, 'Ω': 0xF4, 'ü': 0xF5, 'Σ': 0xF6, 'π': 0xF7,
+		'千': 0xFA, '万': 0xFB, '円': 0xFC, '÷': 0xFD, '█': 0xFF,
+	} {
+		c.codes[r] = code
+	}
+	return c
+}()
+
+// CharsetA02 is the European ROM: ASCII and the symbols and the accented
+// letters of ISO 8859-1 at their Latin-1 codes
+var CharsetA02 = func() *Charset {
+	c := &Charset{
+		Name:  "A02",
+		codes: asciiCodes(),
+		glyphs: map[rune]Glyph{
+			'€': {0x06, 0x09, 0x1C, 0x08, 0x1C, 0x09, 0x06, 0x00},
+		},
+	}
+	// ¡ to ÿ, the soft hyphen prints as a hyphen
+	for r := rune(0xA1); r <= 0xFF; r++ {
+		c.codes[r] = uint8(r)
+	}
+	return c
+}()
+
+// approximations replace the runes neither the ROM nor the glyphs have. A
+// rune is always replaced with a single one, so that the text keeps its
+// width on the display.
+var approximations = func() map[rune]rune {
+	a := map[rune]rune{
+		'ß': 's', 'Æ': 'A', 'æ': 'a', 'Œ': 'O', 'œ': 'o', 'Ø': 'O', 'ø': 'o',
+		'€': 'E', '£': 'L', '©': 'c', '®': 'R', '±': '+', '×': 'x', '÷': '/',
+		'‘': '\'', '’': '\'', '“': '"', '”': '"', '«': '<', '»': '>',
+		'–': '-', '—': '-', '…': '.', '→': '>', '←': '<', '°': 'o', 'µ': 'u', 'μ': 'u',
+		'\u00A0': ' ',
+	}
+	for base, accented := range map[rune]string{
+		'A': "ÀÁÂÃÄÅĀĂĄ", 'a': "àáâãäåāăą", 'C': "ÇĆČ", 'c': "çćč", 'D': "ĎĐ", 'd': "ďđ",
+		'E': "ÈÉÊËĒĖĘĚ", 'e': "èéêëēėęě", 'I': "ÌÍÎÏĪĮ", 'i': "ìíîïīį", 'L': "ŁĽĹ", 'l': "łľĺ",
+		'N': "ÑŃŇ", 'n': "ñńň", 'O': "ÒÓÔÕÖŐŌ", 'o': "òóôõöőō", 'R': "ŘŔ", 'r': "řŕ",
+		'S': "ŚŠŞ", 's': "śšş", 'T': "ŤŢ", 't': "ťţ", 'U': "ÙÚÛÜŮŰŪ", 'u': "ùúûüůűū",
+		'Y': "ÝŸ", 'y': "ýÿ", 'Z': "ŹŻŽ", 'z': "źżž",
+	} {
+		for _, r := range accented {
+			a[r] = base
+		}
+	}
+	return a
+}()
+
+// SetCharset selects the character ROM of the display, CharsetA00 by
+// default
+func (h *hd44780) SetCharset(c *Charset) {
+	h.charset = c
+}
+
+func (h *hd44780) currentCharset() *Charset {
+	if h.charset == nil {
+		return CharsetA00
+	}
+	return h.charset
+}
+
+// code returns the character code of the rune without approximating it
+func (h *hd44780) code(r rune) (code uint8, ok bool, err error) {
+	c := h.currentCharset()
+	if g, found := h.cgram.glyphs[r]; found {
+		code, err = h.glyphCode(g)
+		return code, true, err
+	}
+	if r < CGRAMSlots {
+		// the custom characters by their codes
+		return uint8(r), true, nil
+	}
+	if code, ok = c.codes[r]; ok {
+		return
+	}
+	if g, found := c.glyphs[r]; found {
+		code, err = h.glyphCode(g)
+		return code, true, err
+	}
+	return
+}
+
+// Print writes the text at the cursor. Every rune is looked up in the
+// glyphs registered with RegisterGlyph, then in the character ROM, then in
+// the glyphs the charset brings along; the others are replaced with a
+// look-alike or a question mark. Every rune takes a single cell.
+func (h *hd44780) Print(data string) (err error) {
+	for _, r := range data {
+		code, ok, err := h.code(r)
+		if err != nil {
+			return err
+		}
+		if a, found := approximations[r]; !ok && found {
+			code, ok, err = h.code(a)
+			if err != nil {
+				return err
+			}
+		}
+		if !ok {
+			code = '?'
+		}
+		if err = h.WriteChar(code); err != nil {
+			return err
+		}
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package lcd_hd44780
+
+func (h *hd44780) setControl(flag uint8, on bool) (err error) {
+	control := h.control
+	if on {
+		control |= flag
+	} else {
+		control &^= flag
+	}
+	if err = h.instruction(cmdDisplay | control); err != nil {
+		return
+	}
+	h.control = control
+	return
+}
+
+// Display turns the display on or off, the content is kept
+func (h *hd44780) Display(on bool) error {
+	return h.setControl(displayOn, on)
+}
+
+// Cursor shows or hides the underline cursor
+func (h *hd44780) Cursor(on bool) error {
+	return h.setControl(cursorOn, on)
+}
+
+// Blink turns the blinking block cursor on or off
+func (h *hd44780) Blink(on bool) error {
+	return h.setControl(blinkOn, on)
+}
+
+// Home moves the cursor to the first column of the first row and undoes the
+// display shift
+func (h *hd44780) Home() (err error) {
+	if err = h.command(cmdHome, clearTime); err != nil {
+		return
+	}
+	h.addr = 0
+	return
+}
+
+func (h *hd44780) CursorLeft() (err error) {
+	if err = h.instruction(cmdShift); err != nil {
+		return
+	}
+	h.addr = h.geometry.prev(h.addr)
+	return
+}
+
+func (h *hd44780) CursorRight() (err error) {
+	if err = h.instruction(cmdShift | shiftRight); err != nil {
+		return
+	}
+	h.addr = h.geometry.next(h.addr)
+	return
+}
+
+// ScrollLeft shifts every row of the display left by a column, the cursor
+// moves with the content
+func (h *hd44780) ScrollLeft() error {
+	return h.instruction(cmdShift | shiftDisplay)
+}
+
+// ScrollRight shifts every row of the display right by a column
+func (h *hd44780) ScrollRight() error {
+	return h.instruction(cmdShift | shiftDisplay | shiftRight)
+}
+
+// EntryMode sets where the cursor goes after a character: right if
+// increment is set, left otherwise. With autoscroll the display shifts the
+// other way instead, so the cursor stays in place on the screen.
+func (h *hd44780) EntryMode(increment bool, autoscroll bool) (err error) {
+	entry := uint8(0)
+	if increment {
+		entry |= entryIncrement
+	}
+	if autoscroll {
+		entry |= entryShift
+	}
+	if err = h.instruction(cmdEntryMode | entry); err != nil {
+		return
+	}
+	h.entry = entry
+	return
+}
@@ -0,0 +1,131 @@
+package lcd_hd44780
+
+import (
+	"sync"
+)
+
+// Framebuffer keeps the text of the display in memory. Flush sends only the
+// characters that changed since the previous Flush, so redrawing the whole
+// screen every time doesn't flicker. It assumes the default entry mode.
+type Framebuffer struct {
+	lcd      PiLCD
+	geometry Geometry
+	cells    []rune
+	shown    []rune // nil until the first Flush clears the display
+	mu       sync.Mutex
+}
+
+func NewFramebuffer(lcd PiLCD) (fb *Framebuffer) {
+	g := lcd.Geometry()
+	fb = &Framebuffer{
+		lcd:      lcd,
+		geometry: g,
+		cells:    make([]rune, int(g.Columns)*int(g.Rows)),
+	}
+	fb.Clear()
+	return
+}
+
+func (fb *Framebuffer) index(row, column int) int {
+	return row*int(fb.geometry.Columns) + column
+}
+
+// WriteAt puts the text at the row and the column, continuing on the next
+// row when it doesn't fit and after a new line. What falls off the last
+// row is dropped.
+func (fb *Framebuffer) WriteAt(row, column int, text string) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	columns, rows := int(fb.geometry.Columns), int(fb.geometry.Rows)
+	for _, r := range text {
+		if r == '\n' {
+			row, column = row+1, 0
+			continue
+		}
+		if column >= columns {
+			row, column = row+1, 0
+		}
+		if row < 0 || row >= rows {
+			return
+		}
+		if column >= 0 {
+			fb.cells[fb.index(row, column)] = r
+		}
+		column++
+	}
+}
+
+// Clear blanks the whole buffer
+func (fb *Framebuffer) Clear() {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	for i := range fb.cells {
+		fb.cells[i] = ' '
+	}
+}
+
+// ClearRow blanks a single row
+func (fb *Framebuffer) ClearRow(row int) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if row < 0 || row >= int(fb.geometry.Rows) {
+		return
+	}
+	for c := 0; c < int(fb.geometry.Columns); c++ {
+		fb.cells[fb.index(row, c)] = ' '
+	}
+}
+
+// Invalidate makes the next Flush redraw everything, e.g. after the display
+// was written to directly
+func (fb *Framebuffer) Invalidate() {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	fb.shown = nil
+}
+
+// Flush sends the changed characters. Changes a single unchanged character
+// apart are sent together, which costs the same as moving the cursor. The
+// cells that failed to be sent are sent again by the next Flush.
+func (fb *Framebuffer) Flush() (err error) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+	if fb.shown == nil {
+		if err = fb.lcd.Cls(); err != nil {
+			return
+		}
+		fb.shown = make([]rune, len(fb.cells))
+		for i := range fb.shown {
+			fb.shown[i] = ' '
+		}
+	}
+	columns := int(fb.geometry.Columns)
+	for row := 0; row < int(fb.geometry.Rows); row++ {
+		for start := 0; start < columns; {
+			if fb.cells[fb.index(row, start)] == fb.shown[fb.index(row, start)] {
+				start++
+				continue
+			}
+			end := start + 1
+			for end < columns {
+				if fb.cells[fb.index(row, end)] != fb.shown[fb.index(row, end)] {
+					end++
+				} else if end+1 < columns && fb.cells[fb.index(row, end+1)] != fb.shown[fb.index(row, end+1)] {
+					end += 2
+				} else {
+					break
+				}
+			}
+			changed := fb.cells[fb.index(row, start):fb.index(row, end)]
+			if err = fb.lcd.SetCursor(uint8(row), uint8(start)); err != nil {
+				return
+			}
+			if err = fb.lcd.Print(string(changed)); err != nil {
+				return
+			}
+			copy(fb.shown[fb.index(row, start):], changed)
+			start = end
+		}
+	}
+	return
+}
@@ -0,0 +1,86 @@
+package lcd_hd44780
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Geometry is the size of the display in characters
+type Geometry struct {
+	Columns, Rows uint8
+	// Font5x10 selects the 5x10 dots font, only single row displays have it
+	Font5x10 bool
+}
+
+// Common modules. A 16x1 module wired as two halves of 8 characters is an
+// 8x2 one for the controller.
+var (
+	LCD16x1 = Geometry{Columns: 16, Rows: 1}
+	LCD16x2 = Geometry{Columns: 16, Rows: 2}
+	LCD20x4 = Geometry{Columns: 20, Rows: 4}
+	LCD40x2 = Geometry{Columns: 40, Rows: 2}
+)
+
+// DDRAM sizes, one line mode has a single line of 80 characters
+const (
+	oneLineLength = 0x50
+	twoLineLength = 0x28
+)
+
+func (g Geometry) validate() (err error) {
+	switch {
+	case g.Rows != 1 && g.Rows != 2 && g.Rows != 4:
+		err = errors.New(fmt.Sprintf("%d rows are not supported", g.Rows))
+	case g.Columns == 0 || int(g.Columns)*int(g.Rows) > oneLineLength:
+		err = errors.New(fmt.Sprintf("%dx%d doesn't fit into the display memory", g.Columns, g.Rows))
+	case g.Font5x10 && g.Rows != 1:
+		err = errors.New("5x10 font needs a single row display")
+	}
+	return
+}
+
+// twoLines tells whether the controller runs in 2 line mode, 4 row
+// displays are 2 lines folded in halves
+func (g Geometry) twoLines() bool {
+	return g.Rows > 1
+}
+
+// rowAddress returns the DDRAM address of the first column of the row: rows
+// 2 and 3 continue rows 0 and 1 in the memory
+func (g Geometry) rowAddress(row uint8) (addr uint8) {
+	if row%2 == 1 {
+		addr = LineTwo
+	}
+	if row >= 2 {
+		addr += g.Columns
+	}
+	return
+}
+
+// next returns the address after addr, the way the address counter moves
+func (g Geometry) next(addr uint8) uint8 {
+	addr++
+	switch {
+	case !g.twoLines() && addr == oneLineLength:
+		addr = 0
+	case g.twoLines() && addr == twoLineLength:
+		addr = LineTwo
+	case g.twoLines() && addr == LineTwo+twoLineLength:
+		addr = 0
+	}
+	return addr
+}
+
+// prev returns the address before addr, the way the address counter moves
+// in the decrement mode
+func (g Geometry) prev(addr uint8) uint8 {
+	switch {
+	case !g.twoLines() && addr == 0:
+		return oneLineLength - 1
+	case g.twoLines() && addr == 0:
+		return LineTwo + twoLineLength - 1
+	case g.twoLines() && addr == LineTwo:
+		return twoLineLength - 1
+	}
+	return addr - 1
+}
@@ -0,0 +1,165 @@
+package lcd_hd44780
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/exp/io/i2c"
+)
+
+// PCF8574 addresses with A0..A2 high, the factory setting of most backpacks.
+// The mjkdz backpacks come with A0..A2 low, 0x20.
+const (
+	PCF8574Address  = 0x27
+	PCF8574AAddress = 0x3F
+)
+
+// PCF8574Pins maps the lines of the display to the expander bits, P0..P7
+type PCF8574Pins struct {
+	RS, RW, E, Backlight uint8
+	Data                 [4]uint8 // D4..D7
+	// BacklightActiveLow is set when a low Backlight bit turns the light on
+	BacklightActiveLow bool
+}
+
+var (
+	// PCF8574Common is the wiring of the YwRobot/LCM1602 style backpacks
+	PCF8574Common = PCF8574Pins{RS: 0, RW: 1, E: 2, Backlight: 3, Data: [4]uint8{4, 5, 6, 7}}
+	// PCF8574MJKDZ is the wiring of the mjkdz backpacks
+	PCF8574MJKDZ = PCF8574Pins{RS: 6, RW: 5, E: 4, Backlight: 7, Data: [4]uint8{0, 1, 2, 3}, BacklightActiveLow: true}
+)
+
+func (p PCF8574Pins) validate() (err error) {
+	seen := make(map[uint8]bool)
+	for _, b := range append([]uint8{p.RS, p.RW, p.E, p.Backlight}, p.Data[:]...) {
+		if b > 7 {
+			err = errors.New(fmt.Sprintf("expander bit %d is out of range", b))
+			return
+		}
+		if seen[b] {
+			err = errors.New(fmt.Sprintf("expander bit %d is used twice", b))
+			return
+		}
+		seen[b] = true
+	}
+	return
+}
+
+type i2cDevice interface {
+	Write(buf []byte) error
+	Close() error
+}
+
+// pcf8574Bus is a 4 bit bus behind the I2C expander. RW stays low.
+type pcf8574Bus struct {
+	dev       i2cDevice
+	pins      PCF8574Pins
+	backlight bool
+}
+
+func (b *pcf8574Bus) eightBit() bool {
+	return false
+}
+
+// readable is false: polling the busy flag through the expander takes
+// longer than the instructions themselves
+func (b *pcf8574Bus) readable() bool {
+	return false
+}
+
+func (b *pcf8574Bus) read(rs bool) (uint8, error) {
+	return 0, errNotReadable
+}
+
+// bits returns the expander byte for the nibble
+func (b *pcf8574Bus) bits(rs bool, nibble uint8) (v uint8) {
+	for i, p := range b.pins.Data {
+		if nibble&(1<<uint(i)) > 0 {
+			v |= 1 << p
+		}
+	}
+	if rs {
+		v |= 1 << b.pins.RS
+	}
+	if b.backlight != b.pins.BacklightActiveLow {
+		v |= 1 << b.pins.Backlight
+	}
+	return
+}
+
+// nibble latches the data with a pulse on E, every byte written to the
+// expander changes its outputs
+func (b *pcf8574Bus) nibble(rs bool, nibble uint8) error {
+	v := b.bits(rs, nibble)
+	return b.dev.Write([]byte{v | 1<<b.pins.E, v})
+}
+
+func (b *pcf8574Bus) setup() error {
+	return b.dev.Write([]byte{b.bits(false, 0)})
+}
+
+func (b *pcf8574Bus) reset() (err error) {
+	for _, step := range []struct {
+		nibble uint8
+		delay  time.Duration
+	}{
+		{0x3, 5 * time.Millisecond},
+		{0x3, 150 * time.Microsecond},
+		{0x3, 50 * time.Microsecond},
+		{0x2, 50 * time.Microsecond},
+	} {
+		if err = b.nibble(false, step.nibble); err != nil {
+			return
+		}
+		time.Sleep(step.delay)
+	}
+	return
+}
+
+func (b *pcf8574Bus) write(rs bool, data uint8) error {
+	v1, v2 := b.bits(rs, data>>4), b.bits(rs, data&0x0F)
+	e := uint8(1 << b.pins.E)
+	return b.dev.Write([]byte{v1 | e, v1, v2 | e, v2})
+}
+
+// PiLCDI2C drives the display through a PCF8574 or PCF8574A I2C backpack
+type PiLCDI2C struct {
+	hd44780
+	expander *pcf8574Bus
+}
+
+// NewLCDI2C opens the backpack on /dev/i2c-<bus>. The backlight is on.
+func NewLCDI2C(bus, address int, pins PCF8574Pins, g Geometry) (pLcd PiLCDI2C, err error) {
+	if err = g.validate(); err != nil {
+		return
+	}
+	if err = pins.validate(); err != nil {
+		return
+	}
+	dev, err := i2c.Open(&i2c.Devfs{Dev: fmt.Sprintf("/dev/i2c-%d", bus)}, address)
+	if err != nil {
+		return
+	}
+	pLcd, err = newLCDI2C(dev, pins, g)
+	return
+}
+
+func newLCDI2C(dev i2cDevice, pins PCF8574Pins, g Geometry) (pLcd PiLCDI2C, err error) {
+	pLcd.expander = &pcf8574Bus{dev: dev, pins: pins, backlight: true}
+	err = pLcd.configure(pLcd.expander, g)
+	return
+}
+
+func (r *PiLCDI2C) Backlight(on bool) (err error) {
+	was := r.expander.backlight
+	r.expander.backlight = on
+	if err = r.expander.setup(); err != nil {
+		r.expander.backlight = was
+	}
+	return
+}
+
+func (r *PiLCDI2C) Close() error {
+	return r.expander.dev.Close()
+}
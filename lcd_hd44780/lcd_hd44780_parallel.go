@@ -0,0 +1,206 @@
+package lcd_hd44780
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/stianeikeland/go-rpio"
+)
+
+// pin is the part of rpio.Pin the parallel bus drives
+type pin interface {
+	Output()
+	Input()
+	High()
+	Low()
+	Read() rpio.State
+}
+
+// parallelBus drives the controller through GPIO pins, 4 or 8 data lines
+// starting with the lowest one (D4 or D0)
+type parallelBus struct {
+	// Data pins
+	dataPins []pin
+
+	// register select pin
+	rsPin pin
+
+	// enable pin
+	enablePin pin
+
+	// read/write pin, nil if RW is tied to the ground
+	rwPin pin
+
+	// BCM numbers of the data pins and of RS and E, checked against RW
+	data    []int
+	control []int
+}
+
+// maxPin is the highest GPIO on the 40 pin header, BCM numbering
+const maxPin = 27
+
+func checkPins(data []int, width int, pins ...int) (err error) {
+	if len(data) != width {
+		err = errors.New(fmt.Sprintf("%d data pins expected, got %d", width, len(data)))
+		return
+	}
+	seen := make(map[int]bool)
+	for _, p := range append(append([]int{}, data...), pins...) {
+		if p < 0 || p > maxPin {
+			err = errors.New(fmt.Sprintf("pin %d is out of range", p))
+			return
+		}
+		if seen[p] {
+			err = errors.New(fmt.Sprintf("pin %d is used twice", p))
+			return
+		}
+		seen[p] = true
+	}
+	return
+}
+
+func openParallelBus(data []int, rs int, e int, width int) (b *parallelBus, err error) {
+	if err = checkPins(data, width, rs, e); err != nil {
+		return
+	}
+	if err = rpio.Open(); err != nil {
+		return
+	}
+	b = &parallelBus{
+		rsPin:     rpio.Pin(rs),
+		enablePin: rpio.Pin(e),
+		dataPins:  make([]pin, len(data)),
+		data:      append([]int{}, data...),
+		control:   []int{rs, e},
+	}
+	for i, v := range data {
+		b.dataPins[i] = rpio.Pin(v)
+	}
+	return
+}
+
+// useRW takes the pin for RW, it must not be one of the other pins
+func (b *parallelBus) useRW(rw int) (err error) {
+	if err = checkPins(b.data, len(b.data), append(append([]int{}, b.control...), rw)...); err != nil {
+		return
+	}
+	b.rwPin = rpio.Pin(rw)
+	return
+}
+
+func (b *parallelBus) eightBit() bool {
+	return len(b.dataPins) == 8
+}
+
+func (b *parallelBus) setup() error {
+	b.rsPin.Output()
+	b.enablePin.Output()
+	for _, v := range b.dataPins {
+		v.Output()
+		v.Low()
+	}
+	b.rsPin.Low()     // set RS to low
+	b.enablePin.Low() // set E to low
+	if b.rwPin != nil {
+		b.rwPin.Output()
+		b.rwPin.Low()
+	}
+	return nil
+}
+
+func (b *parallelBus) reset() error {
+	b.rsPin.Low()
+	// function set 8 bit 3 times, the lower 4 lines are ignored in 4 bit mode
+	init := uint8(0x30)
+	if !b.eightBit() {
+		init >>= 4
+	}
+	b.writeBits(init)
+	delayMs(5)
+	b.writeBits(init)
+	delayUs(150)
+	b.writeBits(init)
+	delayUs(50)
+	if !b.eightBit() {
+		// function set 4 bit, still a single transfer
+		b.writeBits(0x02)
+		delayUs(50)
+	}
+	return nil
+}
+
+func (b *parallelBus) setRS(rs bool) {
+	if rs {
+		b.rsPin.High()
+	} else {
+		b.rsPin.Low()
+	}
+	b.enablePin.Low()
+}
+
+// write can't fail, the GPIO registers are memory mapped
+func (b *parallelBus) write(rs bool, data uint8) error {
+	b.setRS(rs)
+	if b.eightBit() {
+		b.writeBits(data)
+		return nil
+	}
+	// write high 4 bits
+	b.writeBits(data >> 4)
+	// write low  bits
+	b.writeBits(data)
+	return nil
+}
+
+func (b *parallelBus) writeBits(data uint8) {
+	for i, v := range b.dataPins {
+		if data&(1<<uint(i)) > 0 {
+			v.High()
+		} else {
+			v.Low()
+		}
+	}
+	b.strobe()
+}
+
+func (b *parallelBus) strobe() {
+	b.enablePin.High()
+	delayUs(2)
+	b.enablePin.Low()
+}
+
+func (b *parallelBus) readable() bool {
+	return b.rwPin != nil
+}
+
+func (b *parallelBus) read(rs bool) (data uint8, err error) {
+	for _, v := range b.dataPins {
+		v.Input()
+	}
+	b.setRS(rs)
+	b.rwPin.High()
+	if b.eightBit() {
+		data = b.readBits()
+	} else {
+		data = b.readBits()<<4 | b.readBits()
+	}
+	b.rwPin.Low()
+	for _, v := range b.dataPins {
+		v.Output()
+	}
+	return
+}
+
+// readBits samples the data lines while E is high
+func (b *parallelBus) readBits() (data uint8) {
+	b.enablePin.High()
+	delayUs(1)
+	for i, v := range b.dataPins {
+		if v.Read() == rpio.High {
+			data |= 1 << uint(i)
+		}
+	}
+	b.enablePin.Low()
+	delayUs(1)
+	return
+}
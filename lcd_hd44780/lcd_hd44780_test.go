@@ -0,0 +1,637 @@
+package lcd_hd44780
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stianeikeland/go-rpio"
+	"github.com/stretchr/testify/assert"
+)
+
+// transfer is the state of the RS and data lines when E falls
+type transfer struct {
+	rs   bool
+	data uint8
+}
+
+type pins struct {
+	state     map[int]bool
+	transfers []transfer
+	data      []int
+	// nibbles (bytes on the 8 bit bus) the controller puts on the data
+	// lines when E rises with RW high, idle once they run out
+	reads []uint8
+	idle  uint8
+}
+
+type fakePin struct {
+	p  *pins
+	id int
+}
+
+const (
+	rsID = 100
+	eID  = 101
+	rwID = 102
+)
+
+func (f fakePin) Output() {}
+
+func (f fakePin) Input() {}
+
+func (f fakePin) High() {
+	if f.id == eID && f.p.state[rwID] {
+		v := f.p.idle
+		if len(f.p.reads) > 0 {
+			v, f.p.reads = f.p.reads[0], f.p.reads[1:]
+		}
+		for i, d := range f.p.data {
+			f.p.state[d] = v&(1<<uint(i)) != 0
+		}
+	}
+	f.p.state[f.id] = true
+}
+
+func (f fakePin) Low() {
+	if f.id == eID && f.p.state[eID] && !f.p.state[rwID] {
+		t := transfer{rs: f.p.state[rsID]}
+		for i, d := range f.p.data {
+			if f.p.state[d] {
+				t.data |= 1 << uint(i)
+			}
+		}
+		f.p.transfers = append(f.p.transfers, t)
+	}
+	f.p.state[f.id] = false
+}
+
+func (f fakePin) Read() rpio.State {
+	if f.p.state[f.id] {
+		return rpio.High
+	}
+	return rpio.Low
+}
+
+func newFakeBus(width int) (b *parallelBus, p *pins) {
+	p = &pins{state: make(map[int]bool)}
+	b = &parallelBus{rsPin: fakePin{p, rsID}, enablePin: fakePin{p, eID}}
+	for i := 0; i < width; i++ {
+		p.data = append(p.data, i)
+		b.dataPins = append(b.dataPins, fakePin{p, i})
+	}
+	return
+}
+
+func instructions(data ...uint8) (res []transfer) {
+	for _, d := range data {
+		res = append(res, transfer{data: d})
+	}
+	return
+}
+
+func TestInit4Bit(t *testing.T) {
+	b, p := newFakeBus(4)
+	var lcd PiLCD4
+	assert.NoError(t, lcd.configure(b, LCD16x2))
+	assert.NoError(t, lcd.Init())
+	assert.Equal(t, instructions(
+		0x3, 0x3, 0x3, 0x2, // reset
+		0x2, 0x8, // function set, 2 lines
+		0x0, 0x8, // display off
+		0x0, 0x1, // clear
+		0x0, 0x6, // entry mode
+		0x0, 0xC, // display on
+	), p.transfers)
+
+	p.transfers = nil
+	assert.NoError(t, lcd.Print("A"))
+	assert.Equal(t, []transfer{{true, 0x4}, {true, 0x1}}, p.transfers)
+}
+
+func TestInit8Bit(t *testing.T) {
+	b, p := newFakeBus(8)
+	var lcd PiLCD8
+	assert.NoError(t, lcd.configure(b, LCD16x2))
+	assert.NoError(t, lcd.Init())
+	assert.Equal(t, instructions(0x30, 0x30, 0x30, 0x38, 0x08, 0x01, 0x06, 0x0C), p.transfers)
+
+	p.transfers = nil
+	assert.NoError(t, lcd.SetCursor(1, 3))
+	assert.NoError(t, lcd.WriteChar('A'))
+	assert.Equal(t, []transfer{{false, 0xC3}, {true, 'A'}}, p.transfers)
+}
+
+// expander latches the lines on the falling edge of E
+type expander struct {
+	pins      PCF8574Pins
+	last      uint8
+	transfers []transfer
+	writes    [][]byte
+	// err fails the writes, the backpack is disconnected
+	err error
+}
+
+func (x *expander) Write(buf []byte) error {
+	if x.err != nil {
+		return x.err
+	}
+	x.writes = append(x.writes, buf)
+	for _, v := range buf {
+		e := uint8(1 << x.pins.E)
+		if x.last&e != 0 && v&e == 0 {
+			t := transfer{rs: v&(1<<x.pins.RS) != 0}
+			for i, p := range x.pins.Data {
+				if v&(1<<p) != 0 {
+					t.data |= 1 << uint(i)
+				}
+			}
+			x.transfers = append(x.transfers, t)
+		}
+		x.last = v
+	}
+	return nil
+}
+
+func (x *expander) Close() error {
+	return nil
+}
+
+func TestI2C(t *testing.T) {
+	for _, pins := range []PCF8574Pins{PCF8574Common, PCF8574MJKDZ} {
+		x := &expander{pins: pins}
+		lcd, err := newLCDI2C(x, pins, LCD16x2)
+		assert.NoError(t, err)
+		assert.NoError(t, lcd.Init())
+		assert.Equal(t, instructions(0x3, 0x3, 0x3, 0x2, 0x2, 0x8, 0x0, 0x8, 0x0, 0x1, 0x0, 0x6, 0x0, 0xC), x.transfers)
+
+		x.transfers = nil
+		assert.NoError(t, lcd.Print("A"))
+		assert.Equal(t, []transfer{{true, 0x4}, {true, 0x1}}, x.transfers)
+		on, off := uint8(1<<pins.Backlight), uint8(0)
+		if pins.BacklightActiveLow {
+			on, off = off, on
+		}
+		for _, w := range x.writes {
+			for _, v := range w {
+				assert.Equal(t, on, v&(1<<pins.Backlight), "backlight stays on")
+			}
+		}
+
+		assert.NoError(t, lcd.Backlight(false))
+		assert.Equal(t, []byte{off}, x.writes[len(x.writes)-1])
+	}
+}
+
+func TestI2CBacklightActiveLow(t *testing.T) {
+	x := &expander{pins: PCF8574MJKDZ}
+	lcd, err := newLCDI2C(x, PCF8574MJKDZ, LCD16x2)
+	assert.NoError(t, err)
+	assert.NoError(t, lcd.Backlight(false))
+	assert.Equal(t, []byte{0x80}, x.writes[len(x.writes)-1])
+	assert.NoError(t, lcd.Backlight(true))
+	assert.Equal(t, []byte{0x00}, x.writes[len(x.writes)-1])
+}
+
+func TestI2CWriteError(t *testing.T) {
+	x := &expander{pins: PCF8574Common}
+	lcd, err := newLCDI2C(x, PCF8574Common, LCD16x2)
+	assert.NoError(t, err)
+	assert.NoError(t, lcd.Init())
+
+	x.err = errors.New("remote I/O error")
+	assert.Equal(t, x.err, lcd.Print("A"))
+	assert.Equal(t, x.err, lcd.SetCursor(1, 0))
+	assert.Equal(t, x.err, lcd.Cls())
+	assert.Equal(t, x.err, lcd.Backlight(false))
+	assert.True(t, lcd.expander.backlight, "unchanged")
+	assert.Equal(t, x.err, lcd.Cursor(true))
+	assert.Equal(t, uint8(displayOn), lcd.control, "unchanged")
+	assert.Equal(t, x.err, lcd.Init())
+
+	x.err = nil
+	assert.NoError(t, lcd.Init())
+}
+
+func TestPinValidation(t *testing.T) {
+	assert.NoError(t, checkPins([]int{4, 5, 6, 7}, 4, 8, 9))
+	assert.Error(t, checkPins([]int{4, 5, 6}, 4, 8, 9), "3 data pins")
+	assert.Error(t, checkPins([]int{4, 5, 6, 7}, 8, 8, 9), "4 data pins on the 8 bit bus")
+	assert.Error(t, checkPins([]int{4, 5, 6, 7}, 4, 8, 28), "no GPIO 28")
+	assert.Error(t, checkPins([]int{4, 5, 6, -1}, 4, 8, 9))
+	assert.Error(t, checkPins([]int{4, 5, 6, 7}, 4, 7, 9), "7 twice")
+
+	for _, lcd := range []interface{ UseRWPin(int) error }{
+		&PiLCD4{parallel: &parallelBus{data: []int{4, 5, 6, 7}, control: []int{8, 9}}},
+		&PiLCD8{parallel: &parallelBus{data: []int{0, 1, 2, 3, 4, 5, 6, 7}, control: []int{8, 9}}},
+	} {
+		assert.Error(t, lcd.UseRWPin(28), "no GPIO 28")
+		assert.Error(t, lcd.UseRWPin(4), "data pin")
+		assert.Error(t, lcd.UseRWPin(9), "E")
+		assert.NoError(t, lcd.UseRWPin(10))
+	}
+
+	_, err := NewLCD4([]int{4, 5, 6}, 8, 9, LCD16x2)
+	assert.Error(t, err)
+	_, err = NewLCD8([]int{4, 5, 6, 7}, 8, 9, LCD16x2)
+	assert.Error(t, err)
+
+	assert.NoError(t, PCF8574Common.validate())
+	assert.NoError(t, PCF8574MJKDZ.validate())
+	assert.Error(t, PCF8574Pins{RS: 0, RW: 1, E: 2, Backlight: 8, Data: [4]uint8{4, 5, 6, 7}}.validate())
+	assert.Error(t, PCF8574Pins{RS: 0, RW: 1, E: 2, Backlight: 3, Data: [4]uint8{4, 5, 6, 2}}.validate())
+}
+
+func TestDefineChar(t *testing.T) {
+	b, p := newFakeBus(8)
+	var lcd PiLCD8
+	assert.NoError(t, lcd.configure(b, LCD16x2))
+	lcd.SetCursor(1, 2)
+	p.transfers = nil
+	assert.NoError(t, lcd.DefineChar(3, GlyphLock))
+	expected := instructions(0x58)
+	for _, row := range GlyphLock {
+		expected = append(expected, transfer{true, row})
+	}
+	expected = append(expected, instructions(0xC2)...)
+	assert.Equal(t, expected, p.transfers)
+}
+
+func TestGlyphSlots(t *testing.T) {
+	b, p := newFakeBus(8)
+	var lcd PiLCD8
+	assert.NoError(t, lcd.configure(b, LCD16x2))
+	for i := 0; i < 9; i++ {
+		lcd.RegisterGlyph(rune('a'+i), Glyph{uint8(i)})
+	}
+	lcd.RegisterGlyph('🔒', GlyphLock)
+
+	lcd.Print("abcdefgh")
+	for i := 0; i < 8; i++ {
+		assert.Equal(t, Glyph{uint8(i)}, lcd.cgram.slots[i].glyph)
+	}
+
+	// a is printed again, b is the least recently used
+	p.transfers = nil
+	lcd.Print("ai")
+	assert.Equal(t, Glyph{8}, lcd.cgram.slots[1].glyph)
+	assert.Equal(t, transfer{true, 0}, p.transfers[0], "a is still in slot 0")
+	assert.Equal(t, transfer{true, 1}, p.transfers[len(p.transfers)-1], "i went to slot 1")
+
+	p.transfers = nil
+	lcd.Print("x🔒")
+	assert.Equal(t, GlyphLock, lcd.cgram.slots[2].glyph)
+	assert.Equal(t, transfer{true, 'x'}, p.transfers[0])
+	assert.Equal(t, transfer{true, 2}, p.transfers[len(p.transfers)-1])
+}
+
+func TestGeometry(t *testing.T) {
+	for _, g := range []Geometry{{Columns: 16, Rows: 3}, {Columns: 0, Rows: 1}, {Columns: 41, Rows: 2}, {Columns: 16, Rows: 2, Font5x10: true}} {
+		assert.Error(t, g.validate(), "%v", g)
+	}
+
+	b, p := newFakeBus(8)
+	var lcd PiLCD8
+	assert.NoError(t, lcd.configure(b, LCD20x4))
+	for row, addr := range []uint8{0x00, 0x40, 0x14, 0x54} {
+		p.transfers = nil
+		lcd.SetCursor(uint8(row), 1)
+		assert.Equal(t, instructions(0x80|addr+1), p.transfers)
+	}
+	p.transfers = nil
+	assert.Error(t, lcd.SetCursor(4, 0))
+	assert.Error(t, lcd.SetCursor(0, 20))
+	assert.Empty(t, p.transfers, "out of the display")
+
+	// the end of row 0 continues on row 2
+	lcd.SetCursor(0, 19)
+	lcd.WriteChar('x')
+	assert.Equal(t, LCD20x4.rowAddress(2), lcd.addr)
+}
+
+func TestFont5x10(t *testing.T) {
+	b, p := newFakeBus(8)
+	var lcd PiLCD8
+	assert.NoError(t, lcd.configure(b, Geometry{Columns: 16, Rows: 1, Font5x10: true}))
+	lcd.Init()
+	assert.Equal(t, transfer{false, 0x34}, p.transfers[3], "function set, 1 line, 5x10")
+
+	p.transfers = nil
+	assert.Error(t, lcd.DefineChar(5, GlyphLock), "4 slots")
+	assert.Empty(t, p.transfers)
+	assert.NoError(t, lcd.DefineChar(1, GlyphLock))
+	assert.Equal(t, transfer{false, 0x50}, p.transfers[0], "slot 1 of 4")
+	assert.Equal(t, 1+11+1, len(p.transfers))
+	assert.Equal(t, uint8(2), lcd.SlotCode(1))
+
+	// the glyph already in slot 1 is printed as code 2
+	lcd.RegisterGlyph('🔒', GlyphLock)
+	p.transfers = nil
+	assert.NoError(t, lcd.Print("🔒"))
+	assert.Equal(t, []transfer{{true, 0x02}}, p.transfers)
+
+	// a new glyph goes to the unused slot 0, code 0
+	lcd.RegisterGlyph('🔋', GlyphBattery)
+	p.transfers = nil
+	assert.NoError(t, lcd.Print("🔋"))
+	assert.Equal(t, transfer{false, 0x40}, p.transfers[0])
+	assert.Equal(t, transfer{true, 0x00}, p.transfers[len(p.transfers)-1])
+}
+
+func TestBusyFlag(t *testing.T) {
+	b, p := newFakeBus(4)
+	b.rwPin = fakePin{p, rwID}
+	lcd := PiLCD4{parallel: b}
+	assert.NoError(t, lcd.configure(b, LCD16x2))
+	// busy twice after the function set, then never again
+	p.reads = []uint8{0x8, 0x0, 0x8, 0x0}
+	assert.NoError(t, lcd.Init())
+	assert.True(t, lcd.polling)
+	assert.Empty(t, p.reads)
+
+	// address counter 0x45
+	p.reads = []uint8{0x4, 0x5}
+	addr, err := lcd.ReadAddress()
+	assert.NoError(t, err)
+	assert.Equal(t, uint8(0x45), addr)
+
+	lcd.SetCursor(1, 2)
+	p.transfers = nil
+	p.reads = []uint8{0, 0, 0x4, 0x8, 0, 0, 0x4, 0x9}
+	data, err := lcd.ReadDDRAM(0, 0, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("HI"), data)
+	assert.Equal(t, instructions(0x8, 0x0, 0xC, 0x2), p.transfers, "the cursor goes back")
+	assert.True(t, lcd.polling)
+}
+
+func TestBusyTimeout(t *testing.T) {
+	b, p := newFakeBus(8)
+	b.rwPin = fakePin{p, rwID}
+	lcd := PiLCD8{parallel: b}
+	assert.NoError(t, lcd.configure(b, LCD16x2))
+	// the lines float high, the display looks busy forever
+	p.idle = 0xFF
+	assert.NoError(t, lcd.Init())
+	assert.False(t, lcd.polling, "back to the delays")
+	assert.Equal(t, 8, len(p.transfers))
+}
+
+func TestNotReadable(t *testing.T) {
+	b, _ := newFakeBus(4)
+	lcd := PiLCD4{parallel: b}
+	assert.NoError(t, lcd.configure(b, LCD16x2))
+	_, err := lcd.ReadAddress()
+	assert.Error(t, err)
+	_, err = lcd.ReadDDRAM(0, 0, 1)
+	assert.Error(t, err)
+}
+
+func TestControl(t *testing.T) {
+	b, p := newFakeBus(8)
+	var lcd PiLCD8
+	assert.NoError(t, lcd.configure(b, LCD16x2))
+	lcd.Init()
+	p.transfers = nil
+
+	lcd.Cursor(true)
+	lcd.Blink(true)
+	lcd.Cursor(false)
+	lcd.Display(false)
+	lcd.Display(true)
+	lcd.ScrollLeft()
+	lcd.ScrollRight()
+	lcd.EntryMode(false, true)
+	lcd.Home()
+	assert.Equal(t, instructions(0x0E, 0x0F, 0x0D, 0x09, 0x0D, 0x18, 0x1C, 0x05, 0x02), p.transfers)
+
+	// the cursor moves left now, from row 1 back to the end of row 0
+	lcd.EntryMode(false, false)
+	lcd.SetCursor(1, 0)
+	lcd.WriteChar('x')
+	assert.Equal(t, uint8(0x27), lcd.addr)
+	lcd.CursorRight()
+	assert.Equal(t, uint8(LineTwo), lcd.addr)
+	lcd.CursorLeft()
+	lcd.CursorLeft()
+	assert.Equal(t, uint8(0x26), lcd.addr)
+}
+
+func TestFramebuffer(t *testing.T) {
+	b, p := newFakeBus(8)
+	lcd := &PiLCD8{parallel: b}
+	assert.NoError(t, lcd.configure(b, LCD16x2))
+	fb := NewFramebuffer(lcd)
+
+	fb.WriteAt(0, 14, "abcd")
+	assert.NoError(t, fb.Flush())
+	assert.Equal(t, []transfer{
+		{false, 0x01},
+		{false, 0x8E}, {true, 'a'}, {true, 'b'},
+		{false, 0xC0}, {true, 'c'}, {true, 'd'},
+	}, p.transfers, "clear, then the text wrapped to row 1")
+
+	p.transfers = nil
+	fb.WriteAt(0, 14, "abcd")
+	fb.Flush()
+	assert.Empty(t, p.transfers, "nothing changed")
+
+	// one unchanged character between the changes is sent along
+	fb.WriteAt(1, 0, "xdy")
+	fb.Flush()
+	assert.Equal(t, []transfer{{false, 0xC0}, {true, 'x'}, {true, 'd'}, {true, 'y'}}, p.transfers)
+
+	p.transfers = nil
+	fb.ClearRow(1)
+	fb.WriteAt(1, 1, "d")
+	fb.Flush()
+	assert.Equal(t, []transfer{{false, 0xC0}, {true, ' '}, {true, 'd'}, {true, ' '}}, p.transfers)
+
+	p.transfers = nil
+	fb.WriteAt(0, 0, "1\n2")
+	fb.WriteAt(1, 15, "xyz")
+	fb.Clear()
+	fb.WriteAt(0, 0, "1")
+	fb.Flush()
+	assert.Equal(t, []transfer{{false, 0x80}, {true, '1'}, {false, 0x8E}, {true, ' '}, {true, ' '}, {false, 0xC1}, {true, ' '}}, p.transfers)
+
+	p.transfers = nil
+	fb.Invalidate()
+	fb.Flush()
+	assert.Equal(t, []transfer{{false, 0x01}, {false, 0x80}, {true, '1'}}, p.transfers)
+
+	// an approximated rune takes one cell, the next one stays in place
+	p.transfers = nil
+	fb.WriteAt(0, 0, "©x")
+	fb.Flush()
+	assert.Equal(t, []transfer{{false, 0x80}, {true, 'c'}, {true, 'x'}}, p.transfers)
+	p.transfers = nil
+	fb.WriteAt(0, 1, "y")
+	fb.Flush()
+	assert.Equal(t, []transfer{{false, 0x81}, {true, 'y'}}, p.transfers)
+}
+
+func TestFramebufferError(t *testing.T) {
+	x := &expander{pins: PCF8574Common}
+	lcd, err := newLCDI2C(x, PCF8574Common, LCD16x2)
+	assert.NoError(t, err)
+	fb := NewFramebuffer(&lcd)
+	assert.NoError(t, fb.Flush())
+
+	fb.WriteAt(1, 0, "ab")
+	x.err = errors.New("remote I/O error")
+	assert.Error(t, fb.Flush())
+
+	// the text is sent again once the display is back
+	x.err = nil
+	x.transfers = nil
+	assert.NoError(t, fb.Flush())
+	assert.Equal(t, 6, len(x.transfers), "cursor, a and b")
+}
+
+func printed(t *testing.T, lcd PiLCD, p *pins, text string) (codes []uint8) {
+	p.transfers = nil
+	lcd.Print(text)
+	for _, tr := range p.transfers {
+		if tr.rs {
+			codes = append(codes, tr.data)
+		}
+	}
+	return
+}
+
+func TestCharset(t *testing.T) {
+	b, p := newFakeBus(8)
+	lcd := &PiLCD8{parallel: b}
+	assert.NoError(t, lcd.configure(b, LCD16x2))
+
+	assert.Equal(t, []uint8{'2', '5', 0xDF, 'C', ' ', 0xE4, 'A', 0x7E}, printed(t, lcd, p, "25°C µA→"))
+	assert.Equal(t, []uint8{0xB1, 0xB2}, printed(t, lcd, p, "ｱｲ"))
+	assert.Equal(t, []uint8{'R', 'e', 'n', 'e', '?'}, printed(t, lcd, p, "René☃"))
+	assert.Equal(t, []uint8{0x03}, printed(t, lcd, p, "\x03"), "custom characters by code")
+
+	// the backslash isn't in A00, it gets a glyph
+	p.transfers = nil
+	lcd.Print("\\")
+	assert.Equal(t, transfer{true, 0}, p.transfers[len(p.transfers)-1])
+	assert.Equal(t, CharsetA00.glyphs['\\'], lcd.cgram.slots[0].glyph)
+
+	lcd.SetCharset(CharsetA02)
+	assert.Equal(t, []uint8{'R', 'e', 'n', 0xE9, '\\'}, printed(t, lcd, p, "René\\"))
+	assert.Equal(t, []uint8{'1', '0', '0', 0xB5}, printed(t, lcd, p, "100µ"))
+	assert.Equal(t, []uint8{'2', '5', 0xB0, 'C', ' ', 0xB1, 0xA3, 0xA9}, printed(t, lcd, p, "25°C ±£©"))
+	assert.Equal(t, []uint8{'a', '.', '"', '>', '?'}, printed(t, lcd, p, "a…”→☃"), "a cell per rune")
+
+	// registered glyphs come first
+	lcd.RegisterGlyph('é', GlyphLock)
+	codes := printed(t, lcd, p, "René")
+	assert.Equal(t, uint8(1), codes[len(codes)-1])
+	assert.Equal(t, GlyphLock, lcd.cgram.slots[1].glyph)
+}
+
+func TestAlign(t *testing.T) {
+	assert.Equal(t, "ab    ", Align("ab", 6, AlignLeft))
+	assert.Equal(t, "  ab  ", Align("ab", 6, AlignCenter))
+	assert.Equal(t, " ab  ", Align("ab", 5, AlignCenter))
+	assert.Equal(t, "    ab", Align("ab", 6, AlignRight))
+	assert.Equal(t, "  °C", Align("°C", 4, AlignRight), "runes, not bytes")
+	assert.Equal(t, "abc", Align("abcdef", 3, AlignRight))
+}
+
+func shownRow(fb *Framebuffer, row int) string {
+	return string(fb.cells[fb.index(row, 0):fb.index(row+1, 0)])
+}
+
+func TestMarquee(t *testing.T) {
+	b, _ := newFakeBus(8)
+	lcd := &PiLCD8{parallel: b}
+	assert.NoError(t, lcd.configure(b, Geometry{Columns: 8, Rows: 2}))
+	fb := NewFramebuffer(lcd)
+	fb.WriteAt(0, 0, "header")
+
+	_, err := NewMarquee(fb, 2, "below the display")
+	assert.Error(t, err)
+	m, err := NewMarquee(fb, 1, "0123456789")
+	assert.NoError(t, err)
+	m.Gap = " "
+	m.draw()
+	assert.Equal(t, "01234567", shownRow(fb, 1))
+	for i := 0; i < 9; i++ {
+		m.offset++
+		m.draw()
+	}
+	assert.Equal(t, "9 012345", shownRow(fb, 1))
+	m.offset += 2
+	m.draw()
+	assert.Equal(t, "01234567", shownRow(fb, 1), "around again")
+	assert.Equal(t, "header  ", shownRow(fb, 0), "other rows untouched")
+
+	m.text = "hi"
+	m.Align = AlignCenter
+	m.draw()
+	assert.Equal(t, "   hi   ", shownRow(fb, 1))
+
+	// a line break stays on the row of the marquee
+	fb.WriteAt(0, 0, "header")
+	m.text = "a\nb"
+	m.draw()
+	assert.Equal(t, "  a b   ", shownRow(fb, 1))
+	m.text = "one\ntwo\nthree"
+	m.offset = 0
+	m.draw()
+	assert.Equal(t, "one two ", shownRow(fb, 1))
+	assert.Equal(t, "header  ", shownRow(fb, 0))
+}
+
+func TestPager(t *testing.T) {
+	b, _ := newFakeBus(8)
+	lcd := &PiLCD8{parallel: b}
+	assert.NoError(t, lcd.configure(b, Geometry{Columns: 8, Rows: 4}))
+	fb := NewFramebuffer(lcd)
+
+	_, err := NewPager(fb, 4, 1, "below the display")
+	assert.Error(t, err)
+	p, err := NewPager(fb, 1, 0, "one\nlong line here\nlast")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, p.rows, "the rest of the display")
+	p.rows = 2
+	p.Align = AlignRight
+	p.draw()
+	assert.Equal(t, []string{"     one", "long lin"}, []string{shownRow(fb, 1), shownRow(fb, 2)})
+	p.page++
+	p.draw()
+	assert.Equal(t, []string{"  e here", "    last"}, []string{shownRow(fb, 1), shownRow(fb, 2)})
+	p.page++
+	p.draw()
+	assert.Equal(t, "     one", shownRow(fb, 1), "back to the first page")
+	assert.Equal(t, "        ", shownRow(fb, 3))
+}
+
+func TestWidgetRun(t *testing.T) {
+	x := &expander{pins: PCF8574Common}
+	lcd, err := newLCDI2C(x, PCF8574Common, Geometry{Columns: 8, Rows: 2})
+	assert.NoError(t, err)
+	fb := NewFramebuffer(&lcd)
+
+	m, err := NewMarquee(fb, 0, "0123456789")
+	assert.NoError(t, err)
+	m.Rate = time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- m.Run(ctx) }()
+	m.SetText("short")
+	m.SetText("fits")
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	assert.Equal(t, context.Canceled, <-done)
+	assert.Equal(t, "fits    ", shownRow(fb, 0))
+
+	// a dead display stops the widget
+	x.err = errors.New("remote I/O error")
+	fb.Invalidate()
+	assert.Equal(t, x.err, m.Run(context.Background()))
+
+	m.Rate = 0
+	assert.Error(t, m.Run(context.Background()), "no ticker for a zero rate")
+}
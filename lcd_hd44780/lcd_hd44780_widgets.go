@@ -0,0 +1,248 @@
+package lcd_hd44780
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Alignment places text shorter than the row
+type Alignment int
+
+const (
+	AlignLeft Alignment = iota
+	AlignCenter
+	AlignRight
+)
+
+// Align pads the text with spaces to the width, text longer than the width
+// is cut. The extra space of odd paddings goes to the right when centering.
+func Align(text string, width int, a Alignment) string {
+	runes := []rune(text)
+	if len(runes) >= width {
+		return string(runes[:width])
+	}
+	pad := width - len(runes)
+	left := 0
+	switch a {
+	case AlignCenter:
+		left = pad / 2
+	case AlignRight:
+		left = pad
+	}
+	return strings.Repeat(" ", left) + text + strings.Repeat(" ", pad-left)
+}
+
+// widget is the state the marquee and the pager share: the text, guarded
+// by the mutex, and the way to wake Run up when it changes
+type widget struct {
+	fb      *Framebuffer
+	mu      sync.Mutex
+	text    string
+	updated chan struct{}
+}
+
+func (w *widget) init(fb *Framebuffer) {
+	w.fb = fb
+	w.updated = make(chan struct{}, 1)
+}
+
+func (w *widget) setText(text string) {
+	w.mu.Lock()
+	w.text = text
+	w.mu.Unlock()
+	// a pending update is as good as a new one
+	select {
+	case w.updated <- struct{}{}:
+	default:
+	}
+}
+
+// run draws the first frame and then a frame per tick, starting over when
+// the text changes. It stops when the context is done or Flush fails.
+func (w *widget) run(ctx context.Context, rate time.Duration, restart func(), step func()) (err error) {
+	if rate <= 0 {
+		err = errors.New(fmt.Sprintf("rate %v is not positive", rate))
+		return
+	}
+	ticker := time.NewTicker(rate)
+	defer func() { ticker.Stop() }()
+	w.mu.Lock()
+	restart()
+	w.mu.Unlock()
+	for {
+		if err = w.fb.Flush(); err != nil {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-w.updated:
+			w.mu.Lock()
+			restart()
+			w.mu.Unlock()
+			// a full period for the new text
+			ticker.Stop()
+			ticker = time.NewTicker(rate)
+		case <-ticker.C:
+			w.mu.Lock()
+			step()
+			w.mu.Unlock()
+		}
+	}
+}
+
+// Marquee shows a line of text on a row, scrolling it to the left when it
+// doesn't fit. Run it in a goroutine, SetText changes the text meanwhile.
+type Marquee struct {
+	// Rate is the time between the scroll steps
+	Rate time.Duration
+	// Gap separates the end of the text from its start coming around again
+	Gap string
+	// Align places the text that fits the row
+	Align Alignment
+
+	widget
+	row    int
+	offset int
+}
+
+// NewMarquee returns a marquee on the row of the framebuffer, other rows
+// may be used by other widgets at the same time. The row must be on the
+// display.
+func NewMarquee(fb *Framebuffer, row uint8, text string) (m *Marquee, err error) {
+	if row >= fb.geometry.Rows {
+		err = errors.New(fmt.Sprintf("row %d is outside of the %d rows", row, fb.geometry.Rows))
+		return
+	}
+	marquee := &Marquee{Rate: 400 * time.Millisecond, Gap: "   ", row: int(row)}
+	marquee.init(fb)
+	marquee.text = text
+	m = marquee
+	return
+}
+
+func (m *Marquee) SetText(text string) {
+	m.setText(text)
+}
+
+// Run scrolls the text until the context is done, it returns the context
+// error, the display error or the error of a Rate that is not positive. Set
+// Rate, Gap and Align before.
+func (m *Marquee) Run(ctx context.Context) error {
+	return m.run(ctx, m.Rate, func() {
+		m.offset = 0
+		m.draw()
+	}, func() {
+		m.offset++
+		m.draw()
+	})
+}
+
+// singleLine replaces the line breaks, WriteAt would continue on the rows
+// of the other widgets
+func singleLine(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '\n' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+func (m *Marquee) draw() {
+	columns := int(m.fb.geometry.Columns)
+	line := singleLine(m.text)
+	text := []rune(line)
+	if len(text) <= columns {
+		m.fb.WriteAt(m.row, 0, Align(line, columns, m.Align))
+		return
+	}
+	loop := append(text, []rune(singleLine(m.Gap))...)
+	m.offset %= len(loop)
+	frame := make([]rune, columns)
+	for i := range frame {
+		frame[i] = loop[(m.offset+i)%len(loop)]
+	}
+	m.fb.WriteAt(m.row, 0, string(frame))
+}
+
+// Pager shows a message longer than the display a page at a time. Lines
+// longer than a row are wrapped, a page is as many lines as the pager has
+// rows. Run it in a goroutine, SetText changes the message meanwhile.
+type Pager struct {
+	// Rate is the time a page is shown
+	Rate time.Duration
+	// Align places the lines shorter than the row
+	Align Alignment
+
+	widget
+	row, rows int
+	page      int
+}
+
+// NewPager returns a pager on rows of the framebuffer starting with row,
+// other rows may be used by other widgets at the same time. Rows 0 takes
+// the rest of the display, the row must be on the display.
+func NewPager(fb *Framebuffer, row, rows uint8, text string) (p *Pager, err error) {
+	if row >= fb.geometry.Rows {
+		err = errors.New(fmt.Sprintf("row %d is outside of the %d rows", row, fb.geometry.Rows))
+		return
+	}
+	pager := &Pager{Rate: 3 * time.Second, row: int(row), rows: int(rows)}
+	if left := int(fb.geometry.Rows) - pager.row; pager.rows == 0 || pager.rows > left {
+		pager.rows = left
+	}
+	pager.init(fb)
+	pager.text = text
+	p = pager
+	return
+}
+
+func (p *Pager) SetText(text string) {
+	p.setText(text)
+}
+
+// Run pages through the message until the context is done, it returns the
+// context error, the display error or the error of a Rate that is not
+// positive. Set Rate and Align before.
+func (p *Pager) Run(ctx context.Context) error {
+	return p.run(ctx, p.Rate, func() {
+		p.page = 0
+		p.draw()
+	}, func() {
+		p.page++
+		p.draw()
+	})
+}
+
+// lines splits the message into rows of the display
+func (p *Pager) lines() (lines []string) {
+	columns := int(p.fb.geometry.Columns)
+	for _, line := range strings.Split(p.text, "\n") {
+		runes := []rune(line)
+		for len(runes) > columns {
+			lines = append(lines, string(runes[:columns]))
+			runes = runes[columns:]
+		}
+		lines = append(lines, string(runes))
+	}
+	return
+}
+
+func (p *Pager) draw() {
+	lines := p.lines()
+	pages := (len(lines) + p.rows - 1) / p.rows
+	p.page %= pages
+	columns := int(p.fb.geometry.Columns)
+	for i := 0; i < p.rows; i++ {
+		line := ""
+		if n := p.page*p.rows + i; n < len(lines) {
+			line = lines[n]
+		}
+		p.fb.WriteAt(p.row+i, 0, Align(line, columns, p.Align))
+	}
+}
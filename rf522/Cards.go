@@ -0,0 +1,42 @@
+package rf522
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CardReader is the part of the reader Cards needs
+type CardReader interface {
+	Wait() error
+	ReadUID() ([]byte, error)
+}
+
+// Cards waits for the cards on the reader and calls f with the UID of every
+// card. The reader restarts the field on every wait, so the same card is
+// ignored until it has been out of the field for the hold-off time. Cards
+// returns the error of the reader, e.g. when it is closed, or the first
+// error f returns.
+func Cards(r CardReader, holdOff time.Duration, f func(uid []byte) error) (err error) {
+	var last []byte
+	var lastSeen time.Time
+	for {
+		if err = r.Wait(); err != nil {
+			return
+		}
+		uid, err1 := r.ReadUID()
+		if err1 != nil {
+			logrus.Debug("Can not read UID ", err1)
+			continue
+		}
+		if bytes.Equal(uid, last) && time.Since(lastSeen) < holdOff {
+			lastSeen = time.Now()
+			continue
+		}
+		last, lastSeen = uid, time.Now()
+		if err = f(uid); err != nil {
+			return
+		}
+	}
+}
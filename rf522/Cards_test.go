@@ -0,0 +1,57 @@
+package rf522
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// scriptedReader returns the UIDs one per wait, nil fails the read. Wait
+// fails once they run out.
+type scriptedReader struct {
+	uids [][]byte
+}
+
+func (r *scriptedReader) Wait() error {
+	if len(r.uids) == 0 {
+		return errors.New("closed")
+	}
+	return nil
+}
+
+func (r *scriptedReader) ReadUID() (uid []byte, err error) {
+	uid, r.uids = r.uids[0], r.uids[1:]
+	if uid == nil {
+		err = errors.New("no card")
+	}
+	return
+}
+
+func TestCards(t *testing.T) {
+	r := &scriptedReader{uids: [][]byte{{1}, {1}, nil, {1}, {2}, {1}}}
+	var seen [][]byte
+	err := Cards(r, time.Hour, func(uid []byte) error {
+		seen = append(seen, uid)
+		return nil
+	})
+	assert.EqualError(t, err, "closed")
+	assert.Equal(t, [][]byte{{1}, {2}, {1}}, seen, "a card is held off until another one shows up")
+
+	r = &scriptedReader{uids: [][]byte{{1}, {1}, {2}}}
+	seen = nil
+	Cards(r, 0, func(uid []byte) error {
+		seen = append(seen, uid)
+		return nil
+	})
+	assert.Equal(t, [][]byte{{1}, {1}, {2}}, seen, "no hold-off")
+
+	r = &scriptedReader{uids: [][]byte{{1}, {2}}}
+	stop := errors.New("stop")
+	err = Cards(r, 0, func(uid []byte) error {
+		return stop
+	})
+	assert.Equal(t, stop, err)
+	assert.Equal(t, 1, len(r.uids))
+}
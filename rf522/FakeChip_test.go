@@ -0,0 +1,300 @@
+package rf522
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/jdevelop/gpio"
+)
+
+// fakeCard answers the frames sent by the fake chip. A nil response means
+// the card stays silent.
+type fakeCard interface {
+	transceive(frame []byte, lastBits byte) (resp []byte, respBits byte)
+	auth(mode byte, block byte, key []byte, uid []byte) bool
+}
+
+// fakeChip emulates the MFRC522 command engine on top of the register file:
+// FIFO, CRC coprocessor, MFAuthent and Transceive.
+type fakeChip struct {
+	sync.Mutex
+	regs    [64]byte
+	fifo    []byte
+	card    fakeCard
+	collPos byte // CollReg value reported with the next response, 0 for none
+	sent    [][]byte
+	self    []byte // FIFO content produced by the digital self test
+}
+
+func newFakeRFID(card fakeCard) (r *RFID, chip *fakeChip) {
+	chip = &fakeChip{card: card}
+	r = &RFID{
+		transport: chip,
+		IrqPin:    &fakeIrq{},
+		rfConfig:  DefaultRFConfig(),
+		stop:      make(chan interface{}, 1),
+	}
+	return
+}
+
+func crcA(data []byte) (res []byte) {
+	crc := uint16(0x6363)
+	for _, b := range data {
+		b = b ^ byte(crc)
+		b = b ^ (b << 4)
+		crc = (crc >> 8) ^ uint16(b)<<8 ^ uint16(b)<<3 ^ uint16(b)>>4
+	}
+	res = []byte{byte(crc), byte(crc >> 8)}
+	return
+}
+
+func (c *fakeChip) ReadRegister(address byte) (value byte, err error) {
+	c.Lock()
+	defer c.Unlock()
+	switch address {
+	case commands.FIFODataReg:
+		if len(c.fifo) > 0 {
+			value = c.fifo[0]
+			c.fifo = c.fifo[1:]
+		}
+	case commands.FIFOLevelReg:
+		value = byte(len(c.fifo))
+	default:
+		value = c.regs[address&0x3F]
+	}
+	return
+}
+
+func (c *fakeChip) WriteRegister(address byte, value byte) (err error) {
+	c.Lock()
+	defer c.Unlock()
+	switch address {
+	case commands.FIFODataReg:
+		c.fifo = append(c.fifo, value)
+	case commands.FIFOLevelReg:
+		if value&0x80 != 0 {
+			c.fifo = nil
+		}
+	case commands.CommIrqReg, commands.DivIrqReg:
+		if value&0x80 != 0 {
+			c.regs[address] |= value & 0x7F
+		} else {
+			c.regs[address] &^= value
+		}
+	case commands.CommandReg:
+		c.regs[address] = value
+		c.execute(value & 0x0F)
+	case commands.BitFramingReg:
+		c.regs[address] = value
+		if value&0x80 != 0 && c.regs[commands.CommandReg]&0x0F == commands.PCD_TRANSCEIVE {
+			c.transceive()
+		}
+	default:
+		c.regs[address&0x3F] = value
+	}
+	return
+}
+
+func (c *fakeChip) Close() error {
+	return nil
+}
+
+func (c *fakeChip) execute(command byte) {
+	switch command {
+	case commands.PCD_CALCCRC:
+		if c.regs[commands.AutoTestReg]&0x0F == 0x09 {
+			c.fifo = append([]byte{}, c.self...)
+			return
+		}
+		crc := crcA(c.fifo)
+		c.regs[commands.CRCResultRegL] = crc[0]
+		c.regs[commands.CRCResultRegM] = crc[1]
+		c.regs[commands.DivIrqReg] |= 0x04
+	case commands.PCD_AUTHENT:
+		f := c.fifo
+		c.fifo = nil
+		if len(f) == 12 && c.card.auth(f[0], f[1], f[2:8], f[8:12]) {
+			c.regs[commands.Status2Reg] |= 0x08
+		} else {
+			c.regs[commands.Status2Reg] &^= 0x08
+		}
+		c.regs[commands.CommIrqReg] |= 0x10
+	}
+}
+
+func (c *fakeChip) transceive() {
+	frame := c.fifo
+	c.fifo = nil
+	c.regs[commands.ErrorReg] = 0
+	if c.regs[commands.TxModeReg]&0x80 != 0 {
+		frame = append(frame, crcA(frame)...)
+	}
+	c.sent = append(c.sent, frame)
+	resp, bits := c.card.transceive(frame, c.regs[commands.BitFramingReg]&0x07)
+	if resp == nil {
+		c.regs[commands.CommIrqReg] |= 0x01
+		return
+	}
+	if c.regs[commands.RxModeReg]&0x80 != 0 {
+		if n := len(resp); n < 2 || !bytes.Equal(crcA(resp[:n-2]), resp[n-2:]) {
+			c.regs[commands.ErrorReg] |= ErrCRC
+		} else {
+			resp = resp[:n-2]
+		}
+	}
+	if c.collPos != 0 {
+		c.regs[commands.ErrorReg] |= ErrCollision
+		c.regs[commands.CollReg] = c.collPos
+		c.collPos = 0
+	}
+	c.fifo = append([]byte{}, resp...)
+	c.regs[commands.ControlReg] = bits & 0x07
+	c.regs[commands.CommIrqReg] |= 0x30
+}
+
+// fakeIrq fires the interrupt as soon as the watch starts
+type fakeIrq struct {
+	gpio.Pin
+}
+
+func (p *fakeIrq) BeginWatch(edge gpio.Edge, callback gpio.IRQEvent) error {
+	go callback()
+	return nil
+}
+
+func (p *fakeIrq) EndWatch() error {
+	return nil
+}
+
+// classicCard is a MIFARE Classic 1K with 4 byte UID
+type classicCard struct {
+	uid      []byte
+	blocks   [64][16]byte
+	halted   bool
+	sector   int
+	auths    int
+	writeTo  int
+	selected bool
+	valueCmd byte // pending increment/decrement/restore waiting for the operand
+	valueOf  int
+	register int32
+}
+
+func newClassicCard(uid []byte) (c *classicCard) {
+	c = &classicCard{uid: uid, sector: -1, writeTo: -1}
+	for s := 0; s < 16; s++ {
+		copy(c.blocks[s*4+3][:], []byte{
+			0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x07, 0x80, 0x69, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF,
+		})
+	}
+	return
+}
+
+func (c *classicCard) bcc() byte {
+	return c.uid[0] ^ c.uid[1] ^ c.uid[2] ^ c.uid[3]
+}
+
+func withCRC(data ...byte) []byte {
+	return append(data, crcA(data)...)
+}
+
+func (c *classicCard) transceive(frame []byte, lastBits byte) (resp []byte, bits byte) {
+	if c.writeTo >= 0 {
+		copy(c.blocks[c.writeTo][:], frame[:16])
+		c.writeTo = -1
+		return []byte{0x0A}, 4
+	}
+	if c.valueCmd != 0 {
+		value, _, err := DecodeValue(c.blocks[c.valueOf][:])
+		if err != nil {
+			c.valueCmd = 0
+			return
+		}
+		operand := int32(binary.LittleEndian.Uint32(frame))
+		switch c.valueCmd {
+		case commands.PICC_INCREMENT:
+			value += operand
+		case commands.PICC_DECREMENT:
+			value -= operand
+		}
+		c.register = value
+		c.valueCmd = 0
+		// no answer to the operand
+		return
+	}
+	switch {
+	case lastBits == 7 && frame[0] == commands.PICC_REQIDL && !c.halted,
+		lastBits == 7 && frame[0] == commands.PICC_REQALL:
+		c.halted = false
+		c.selected = false
+		c.sector = -1
+		return []byte{0x04, 0x00}, 0
+	case len(frame) == 2 && frame[0] == commands.PICC_ANTICOLL && frame[1] == 0x20:
+		return append(append([]byte{}, c.uid...), c.bcc()), 0
+	case len(frame) == 9 && frame[0] == commands.PICC_SElECTTAG && frame[1] == 0x70:
+		if !bytes.Equal(frame[2:6], c.uid) {
+			return
+		}
+		c.selected = true
+		return withCRC(0x08), 0
+	case len(frame) == 4 && frame[0] == commands.PICC_HALT:
+		// HLTA is ignored in the READY state
+		if c.selected {
+			c.halted = true
+			c.selected = false
+			c.sector = -1
+		}
+		return
+	case len(frame) == 4 && frame[0] == commands.PICC_READ:
+		if !c.selected || int(frame[1])/4 != c.sector {
+			return
+		}
+		return withCRC(c.blocks[frame[1]][:]...), 0
+	case len(frame) == 4 && frame[0] == commands.PICC_WRITE:
+		if !c.selected || int(frame[1])/4 != c.sector {
+			return
+		}
+		c.writeTo = int(frame[1])
+		return []byte{0x0A}, 4
+	case len(frame) == 4 && (frame[0] == commands.PICC_INCREMENT || frame[0] == commands.PICC_DECREMENT ||
+		frame[0] == commands.PICC_RESTORE):
+		if !c.selected || int(frame[1])/4 != c.sector {
+			return
+		}
+		c.valueCmd = frame[0]
+		c.valueOf = int(frame[1])
+		return []byte{0x0A}, 4
+	case len(frame) == 4 && frame[0] == commands.PICC_TRANSFER:
+		if !c.selected || int(frame[1])/4 != c.sector {
+			return
+		}
+		addr := c.blocks[frame[1]][12]
+		if _, a, err := DecodeValue(c.blocks[c.valueOf][:]); err == nil {
+			addr = a
+		}
+		c.blocks[frame[1]] = EncodeValue(c.register, addr)
+		return []byte{0x0A}, 4
+	}
+	return
+}
+
+func (c *classicCard) auth(mode byte, block byte, key []byte, uid []byte) bool {
+	if !c.selected || !bytes.Equal(uid, c.uid) {
+		return false
+	}
+	c.auths++
+	trailer := c.blocks[block/4*4+3]
+	expected := trailer[0:6]
+	if mode == commands.PICC_AUTHENT1B {
+		expected = trailer[10:16]
+	}
+	if !bytes.Equal(key, expected) {
+		c.sector = -1
+		c.selected = false
+		return false
+	}
+	c.sector = int(block / 4)
+	return true
+}
@@ -0,0 +1,182 @@
+package rf522
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ReaderConfig describes a single reader attached to the host
+type ReaderConfig struct {
+	ID       string
+	Bus      int
+	Device   int
+	MaxSpeed int
+	ResetPin int
+	IrqPin   int
+}
+
+// CardEvent is emitted every time a reader detects a card
+type CardEvent struct {
+	ReaderID string
+	UID      []byte
+	Time     time.Time
+}
+
+type managedReader struct {
+	id   string
+	rfid *RFID
+	bus  *sync.Mutex
+}
+
+// ReaderManager polls several readers in turn. Readers sharing the same SPI
+// bus never talk to the chip at the same time.
+type ReaderManager struct {
+	PollInterval time.Duration
+	readers      []*managedReader
+	stop         chan interface{}
+	once         sync.Once
+}
+
+func MakeReaderManager(configs []ReaderConfig) (m *ReaderManager, err error) {
+	mgr := &ReaderManager{
+		PollInterval: 100 * time.Millisecond,
+		stop:         make(chan interface{}),
+	}
+	busLocks := make(map[int]*sync.Mutex)
+	ids := make(map[string]bool)
+	for _, c := range configs {
+		if ids[c.ID] {
+			err = errors.New(fmt.Sprintf("duplicate reader id %s", c.ID))
+			mgr.closeReaders()
+			return
+		}
+		ids[c.ID] = true
+		lock, ok := busLocks[c.Bus]
+		if !ok {
+			lock = new(sync.Mutex)
+			busLocks[c.Bus] = lock
+		}
+		lock.Lock()
+		rfid, err1 := MakeRFID(c.Bus, c.Device, c.MaxSpeed, c.ResetPin, c.IrqPin)
+		lock.Unlock()
+		if err1 != nil {
+			err = errors.New(fmt.Sprintf("reader %s: %v", c.ID, err1))
+			mgr.closeReaders()
+			return
+		}
+		mgr.readers = append(mgr.readers, &managedReader{
+			id:   c.ID,
+			rfid: rfid,
+			bus:  lock,
+		})
+	}
+	m = mgr
+	return
+}
+
+func (m *ReaderManager) find(id string) (reader *managedReader, err error) {
+	for _, r := range m.readers {
+		if r.id == id {
+			reader = r
+			return
+		}
+	}
+	err = errors.New(fmt.Sprintf("unknown reader %s", id))
+	return
+}
+
+// Do runs f against the reader with the given id while holding its bus
+func (m *ReaderManager) Do(id string, f func(r *RFID) error) (err error) {
+	reader, err := m.find(id)
+	if err != nil {
+		return
+	}
+	reader.bus.Lock()
+	defer reader.bus.Unlock()
+	err = f(reader.rfid)
+	return
+}
+
+func (m *ReaderManager) poll(reader *managedReader) (uid []byte, err error) {
+	reader.bus.Lock()
+	defer reader.bus.Unlock()
+	reader.rfid.mu.Lock()
+	defer reader.rfid.mu.Unlock()
+	_, err = reader.rfid.request()
+	if err != nil {
+		return
+	}
+	serial, err := reader.rfid.antiColl()
+	if err != nil {
+		return
+	}
+	// only a selected card goes to HALT
+	if _, err = reader.rfid.selectTag(serial); err != nil {
+		return
+	}
+	if err = reader.rfid.halt(); err != nil {
+		return
+	}
+	uid = serial[:4]
+	return
+}
+
+// Run polls every reader in a round-robin fashion and sends an event for
+// every card entering the field of a reader. The card is selected and halted
+// when it is read, so a card kept in the field produces a single event.
+// Run returns when Close is called.
+func (m *ReaderManager) Run(events chan<- CardEvent) {
+	for {
+		for _, reader := range m.readers {
+			select {
+			case <-m.stop:
+				return
+			default:
+			}
+			uid, err1 := m.poll(reader)
+			if err1 != nil {
+				logrus.WithField("reader", reader.id).Debug("Poll: ", err1)
+				continue
+			}
+			select {
+			case <-m.stop:
+				return
+			case events <- CardEvent{
+				ReaderID: reader.id,
+				UID:      uid,
+				Time:     time.Now(),
+			}:
+			}
+		}
+		select {
+		case <-m.stop:
+			return
+		case <-time.After(m.PollInterval):
+		}
+	}
+}
+
+func (m *ReaderManager) closeReaders() (err error) {
+	for _, reader := range m.readers {
+		reader.bus.Lock()
+		if err1 := reader.rfid.Close(); err1 != nil {
+			logrus.WithField("reader", reader.id).Warn("Close: ", err1)
+			err = err1
+		}
+		reader.bus.Unlock()
+	}
+	return
+}
+
+// Close stops Run and releases all the readers
+func (m *ReaderManager) Close() (err error) {
+	m.once.Do(func() {
+		close(m.stop)
+		err = m.closeReaders()
+	})
+	return
+}
@@ -0,0 +1,87 @@
+package rf522
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newFakeManager(cards map[string]*classicCard) (m *ReaderManager, chips map[string]*fakeChip) {
+	m = &ReaderManager{PollInterval: time.Millisecond, stop: make(chan interface{})}
+	chips = make(map[string]*fakeChip)
+	bus := new(sync.Mutex)
+	for _, id := range []string{"door", "desk"} {
+		r, chip := newFakeRFID(cards[id])
+		chips[id] = chip
+		m.readers = append(m.readers, &managedReader{id: id, rfid: r, bus: bus})
+	}
+	return
+}
+
+func TestManagerRoundRobin(t *testing.T) {
+	cards := map[string]*classicCard{
+		"door": newClassicCard([]byte{1, 2, 3, 4}),
+		"desk": newClassicCard([]byte{5, 6, 7, 8}),
+	}
+	m, chips := newFakeManager(cards)
+	events := make(chan CardEvent)
+	go m.Run(events)
+
+	seen := make(map[string][]byte)
+	for i := 0; i < 2; i++ {
+		e := <-events
+		seen[e.ReaderID] = e.UID
+	}
+	assert.Equal(t, map[string][]byte{"door": {1, 2, 3, 4}, "desk": {5, 6, 7, 8}}, seen)
+
+	// both cards stay in the field and are not reported again
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event %+v", e)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// the door card leaves the field and comes back
+	chips["door"].Lock()
+	cards["door"].halted = false
+	chips["door"].Unlock()
+	e := <-events
+	assert.Equal(t, "door", e.ReaderID)
+	assert.Equal(t, []byte{1, 2, 3, 4}, e.UID)
+
+	assert.NoError(t, m.Close())
+}
+
+func TestManagerDo(t *testing.T) {
+	m, chips := newFakeManager(map[string]*classicCard{
+		"door": newClassicCard([]byte{1, 2, 3, 4}),
+		"desk": newClassicCard([]byte{5, 6, 7, 8}),
+	})
+	var uid []byte
+	err := m.Do("desk", func(r *RFID) (err error) {
+		uid, err = r.ReadUID()
+		return
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{5, 6, 7, 8}, uid)
+	assert.Empty(t, chips["door"].sent, "the other reader is left alone")
+
+	assert.Error(t, m.Do("gate", func(r *RFID) error { return nil }))
+
+	events := make(chan CardEvent)
+	done := make(chan interface{})
+	go func() {
+		m.Run(events)
+		close(done)
+	}()
+	<-events
+	assert.NoError(t, m.Close())
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run didn't return")
+	}
+	assert.NoError(t, m.Close(), "closing twice")
+}
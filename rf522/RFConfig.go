@@ -0,0 +1,243 @@
+package rf522
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+)
+
+// RxGain is the receiver gain, as stored in bits 6..4 of RFCfgReg
+type RxGain byte
+
+const (
+	RxGain18dB RxGain = 0x00
+	RxGain23dB RxGain = 0x01
+	RxGain33dB RxGain = 0x04
+	RxGain38dB RxGain = 0x05
+	RxGain43dB RxGain = 0x06
+	RxGain48dB RxGain = 0x07
+)
+
+// CRCPreset is the CRC coprocessor preset value, as stored in bits 1..0 of ModeReg
+type CRCPreset byte
+
+const (
+	CRCPreset0000 CRCPreset = 0x00
+	CRCPreset6363 CRCPreset = 0x01
+	CRCPresetA671 CRCPreset = 0x02
+	CRCPresetFFFF CRCPreset = 0x03
+)
+
+// DemodConfig mirrors the fields of DemodReg
+type DemodConfig struct {
+	AddIQ        byte // 0..3, I/Q channel selection during reception
+	FixIQ        bool // receive on the channel selected by AddIQ only
+	TPrescalEven bool // use the even timer prescaler formula
+	TauRcv       byte // 0..3, PLL time constant during data reception
+	TauSync      byte // 0..3, PLL time constant during burst
+}
+
+// TimerConfig mirrors TModeReg, TPrescalerReg and TReloadReg
+type TimerConfig struct {
+	Auto      bool   // start the timer at the end of every transmission
+	Prescaler uint16 // 12 bit prescaler
+	Reload    uint16 // reload value, the timer counts down from it
+}
+
+// RFConfig holds the analog and timing settings of the reader. Values are
+// applied on every Init() and can be changed live with ApplyRFConfig.
+type RFConfig struct {
+	RxGain      RxGain
+	CWGsN       byte // 0..15, n-driver conductance while no modulation
+	ModGsN      byte // 0..15, n-driver conductance during modulation
+	CWGsP       byte // 0..63, p-driver conductance while no modulation
+	ModGsP      byte // 0..63, p-driver conductance during modulation
+	MinLevel    byte // 0..15, minimum signal strength the decoder accepts
+	CollLevel   byte // 0..7, minimum strength of the weaker half-bit to report a collision
+	Demod       DemodConfig
+	Timer       TimerConfig
+	Force100ASK bool
+	CRCPreset   CRCPreset
+}
+
+// DefaultRFConfig returns the settings the driver has always used: 33dB
+// receiver gain, 100% ASK, CRC preset 0x6363, a 15ms timeout and the
+// chip reset values for everything else.
+func DefaultRFConfig() RFConfig {
+	return RFConfig{
+		RxGain:    RxGain33dB,
+		CWGsN:     0x08,
+		ModGsN:    0x08,
+		CWGsP:     0x20,
+		ModGsP:    0x20,
+		MinLevel:  0x08,
+		CollLevel: 0x04,
+		Demod: DemodConfig{
+			AddIQ:   0x01,
+			TauRcv:  0x03,
+			TauSync: 0x01,
+		},
+		Timer: TimerConfig{
+			Auto:      true,
+			Prescaler: 0xD3E,
+			Reload:    30,
+		},
+		Force100ASK: true,
+		CRCPreset:   CRCPreset6363,
+	}
+}
+
+type regValue struct {
+	address int
+	value   byte
+}
+
+var rfConfigRegisters = []int{
+	commands.TModeReg,
+	commands.TPrescalerReg,
+	commands.TReloadRegL,
+	commands.TReloadRegH,
+	commands.TxAutoReg,
+	commands.ModeReg,
+	commands.GsNReg,
+	commands.CWGsPReg,
+	commands.ModGsPReg,
+	commands.RxThresholdReg,
+	commands.DemodReg,
+	commands.RFCfgReg,
+}
+
+// divider returns the number of 13.56MHz clock cycles per timer tick,
+// DemodReg picks between the odd and the even prescaler formula
+func (c *RFConfig) divider() int64 {
+	if c.Demod.TPrescalEven {
+		return 2*int64(c.Timer.Prescaler) + 2
+	}
+	return 2*int64(c.Timer.Prescaler) + 1
+}
+
+// Timeout returns the time it takes the timer to count down from Reload
+func (c RFConfig) Timeout() time.Duration {
+	ticks := c.divider() * (int64(c.Timer.Reload) + 1)
+	return time.Duration(ticks * int64(time.Second) / 13560000)
+}
+
+func boolBit(v bool, bit byte) byte {
+	if v {
+		return bit
+	}
+	return 0
+}
+
+func (c *RFConfig) validate() (err error) {
+	switch {
+	case c.RxGain > 0x07:
+		err = errors.New(fmt.Sprintf("RxGain out of range: %d", c.RxGain))
+	case c.CWGsN > 0x0F || c.ModGsN > 0x0F:
+		err = errors.New(fmt.Sprintf("GsN out of range: %d/%d", c.CWGsN, c.ModGsN))
+	case c.CWGsP > 0x3F || c.ModGsP > 0x3F:
+		err = errors.New(fmt.Sprintf("GsP out of range: %d/%d", c.CWGsP, c.ModGsP))
+	case c.MinLevel > 0x0F || c.CollLevel > 0x07:
+		err = errors.New(fmt.Sprintf("RxThreshold out of range: %d/%d", c.MinLevel, c.CollLevel))
+	case c.Demod.AddIQ > 0x03 || c.Demod.TauRcv > 0x03 || c.Demod.TauSync > 0x03:
+		err = errors.New(fmt.Sprintf("Demod out of range: %+v", c.Demod))
+	case c.Timer.Prescaler > 0x0FFF:
+		err = errors.New(fmt.Sprintf("Timer prescaler out of range: %d", c.Timer.Prescaler))
+	case c.CRCPreset > 0x03:
+		err = errors.New(fmt.Sprintf("CRC preset out of range: %d", c.CRCPreset))
+	}
+	return
+}
+
+// registers returns the register values in the order they have to be written
+func (c *RFConfig) registers() []regValue {
+	return []regValue{
+		{commands.TModeReg, boolBit(c.Timer.Auto, 0x80) | byte(c.Timer.Prescaler>>8)&0x0F},
+		{commands.TPrescalerReg, byte(c.Timer.Prescaler)},
+		{commands.TReloadRegL, byte(c.Timer.Reload)},
+		{commands.TReloadRegH, byte(c.Timer.Reload >> 8)},
+		{commands.TxAutoReg, boolBit(c.Force100ASK, 0x40)},
+		{commands.ModeReg, 0x3C | byte(c.CRCPreset)},
+		{commands.GsNReg, c.CWGsN<<4 | c.ModGsN},
+		{commands.CWGsPReg, c.CWGsP},
+		{commands.ModGsPReg, c.ModGsP},
+		{commands.RxThresholdReg, c.MinLevel<<4 | c.CollLevel},
+		{commands.DemodReg, c.Demod.AddIQ<<6 | boolBit(c.Demod.FixIQ, 0x20) |
+			boolBit(c.Demod.TPrescalEven, 0x10) | c.Demod.TauRcv<<2 | c.Demod.TauSync},
+		{commands.RFCfgReg, byte(c.RxGain) << 4},
+	}
+}
+
+func parseRFConfig(regs map[int]byte) (c RFConfig) {
+	tMode := regs[commands.TModeReg]
+	c.Timer.Auto = tMode&0x80 != 0
+	c.Timer.Prescaler = uint16(tMode&0x0F)<<8 | uint16(regs[commands.TPrescalerReg])
+	c.Timer.Reload = uint16(regs[commands.TReloadRegH])<<8 | uint16(regs[commands.TReloadRegL])
+	c.Force100ASK = regs[commands.TxAutoReg]&0x40 != 0
+	c.CRCPreset = CRCPreset(regs[commands.ModeReg] & 0x03)
+	c.CWGsN = regs[commands.GsNReg] >> 4
+	c.ModGsN = regs[commands.GsNReg] & 0x0F
+	c.CWGsP = regs[commands.CWGsPReg] & 0x3F
+	c.ModGsP = regs[commands.ModGsPReg] & 0x3F
+	c.MinLevel = regs[commands.RxThresholdReg] >> 4
+	c.CollLevel = regs[commands.RxThresholdReg] & 0x07
+	demod := regs[commands.DemodReg]
+	c.Demod = DemodConfig{
+		AddIQ:        demod >> 6,
+		FixIQ:        demod&0x20 != 0,
+		TPrescalEven: demod&0x10 != 0,
+		TauRcv:       (demod >> 2) & 0x03,
+		TauSync:      demod & 0x03,
+	}
+	c.RxGain = RxGain((regs[commands.RFCfgReg] >> 4) & 0x07)
+	return
+}
+
+func (r *RFID) writeRFConfig(c *RFConfig) (err error) {
+	for _, v := range c.registers() {
+		err = r.devWrite(v.address, v.value)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// ApplyRFConfig writes the configuration to the chip immediately and keeps
+// it for the subsequent calls to Init()
+func (r *RFID) ApplyRFConfig(c RFConfig) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = r.applyRFConfig(c)
+	return
+}
+
+func (r *RFID) applyRFConfig(c RFConfig) (err error) {
+	err = c.validate()
+	if err != nil {
+		return
+	}
+	err = r.writeRFConfig(&c)
+	if err != nil {
+		return
+	}
+	r.rfConfig = c
+	return
+}
+
+// ReadRFConfig reads the configuration currently active in the chip
+func (r *RFID) ReadRFConfig() (c RFConfig, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	regs := make(map[int]byte, len(rfConfigRegisters))
+	for _, addr := range rfConfigRegisters {
+		regs[addr], err = r.devRead(addr)
+		if err != nil {
+			return
+		}
+	}
+	c = parseRFConfig(regs)
+	return
+}
@@ -0,0 +1,88 @@
+package rf522
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultRFConfig(t *testing.T) {
+	cfg := DefaultRFConfig()
+	assert.NoError(t, cfg.validate())
+
+	regs := make(map[int]byte)
+	for _, v := range cfg.registers() {
+		regs[v.address] = v.value
+	}
+
+	// values Init() used to hard-code
+	assert.Equal(t, byte(0x8D), regs[commands.TModeReg])
+	assert.Equal(t, byte(0x3E), regs[commands.TPrescalerReg])
+	assert.Equal(t, byte(30), regs[commands.TReloadRegL])
+	assert.Equal(t, byte(0), regs[commands.TReloadRegH])
+	assert.Equal(t, byte(0x40), regs[commands.TxAutoReg])
+	assert.Equal(t, byte(0x3D), regs[commands.ModeReg])
+	assert.Equal(t, byte(0x40), regs[commands.RFCfgReg])
+
+	// chip reset values
+	assert.Equal(t, byte(0x88), regs[commands.GsNReg])
+	assert.Equal(t, byte(0x84), regs[commands.RxThresholdReg])
+	assert.Equal(t, byte(0x4D), regs[commands.DemodReg])
+
+	assert.Equal(t, cfg, parseRFConfig(regs))
+
+	assert.InDelta(t, float64(15500*time.Microsecond), float64(cfg.Timeout()), float64(100*time.Microsecond))
+}
+
+func TestRFConfigRoundTrip(t *testing.T) {
+	cfg := RFConfig{
+		RxGain:    RxGain48dB,
+		CWGsN:     0x0F,
+		ModGsN:    0x02,
+		CWGsP:     0x3F,
+		ModGsP:    0x11,
+		MinLevel:  0x05,
+		CollLevel: 0x07,
+		Demod: DemodConfig{
+			AddIQ:        0x02,
+			FixIQ:        true,
+			TPrescalEven: true,
+			TauRcv:       0x01,
+			TauSync:      0x02,
+		},
+		Timer: TimerConfig{
+			Prescaler: 0xA9B,
+			Reload:    0x1234,
+		},
+		CRCPreset: CRCPresetFFFF,
+	}
+	regs := make(map[int]byte)
+	for _, v := range cfg.registers() {
+		regs[v.address] = v.value
+	}
+	assert.Equal(t, cfg, parseRFConfig(regs))
+
+	cfg.CWGsP = 0x40
+	assert.Error(t, cfg.validate())
+}
+
+func TestTimeoutEvenPrescaler(t *testing.T) {
+	cfg := DefaultRFConfig()
+	cfg.Timer = TimerConfig{Prescaler: 0x0A, Reload: 99}
+	// 13.56MHz / 21 and 13.56MHz / 22
+	assert.Equal(t, 21*100*time.Second/13560000, cfg.Timeout())
+	cfg.Demod.TPrescalEven = true
+	assert.Equal(t, 22*100*time.Second/13560000, cfg.Timeout())
+}
+
+func TestSetAntennaGain(t *testing.T) {
+	r, chip := newFakeRFID(newClassicCard([]byte{1, 2, 3, 4}))
+	assert.NoError(t, r.SetAntennaGain(7))
+	assert.Equal(t, byte(0x70), chip.regs[commands.RFCfgReg], "written without Init")
+	assert.Equal(t, RxGain48dB, r.rfConfig.RxGain)
+
+	assert.Error(t, r.SetAntennaGain(8))
+	assert.Equal(t, byte(0x70), chip.regs[commands.RFCfgReg])
+}
@@ -3,70 +3,107 @@ package rf522
 import (
 	"errors"
 	"fmt"
+	"sync"
 	"time"
 
-	"github.com/ecc1/spi"
 	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
 	"github.com/jdevelop/gpio"
 	rpio "github.com/jdevelop/gpio/rpi"
 	"github.com/sirupsen/logrus"
 )
 
+// RFID is safe for concurrent use. Every exported method runs as a single
+// operation under the reader lock, so register sequences of different
+// goroutines never interleave. Wait releases the lock while it sleeps
+// between the card polls and only one goroutine waits at a time.
+// The card operations (ReadCard, WriteBlock, ReadAuth, WriteSectorTrail)
+// wait for the card first and then hold the lock for the whole select,
+// authentication and transfer sequence. A sequence composed of several
+// low level calls (Request, AntiColl, SelectTag, Auth, ...) is not atomic.
+//
+// The pins and MaxSpeedHz must not be changed after the reader was created.
 type RFID struct {
 	ResetPin      gpio.Pin
 	IrqPin        gpio.Pin
-	Authenticated bool
-	antennaGain   int
 	MaxSpeedHz    int
-	spiDev        *spi.Device
+	authenticated bool
+	rfConfig      RFConfig
+	transport     Transport
+	tracer        Tracer
 	stop          chan interface{}
+	mu            sync.Mutex
+	waitMu        sync.Mutex
 }
 
 var DefaultKey = []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
 
-func MakeRFID(busId, deviceId, maxSpeed, resetPin, irqPin int) (device *RFID, err error) {
-
-	spiDev, err := spi.Open(fmt.Sprintf("/dev/spidev%d.%d", busId, deviceId), maxSpeed, 0)
+// ErrTimeout is reported when the chip timer expires before the card answers
+var ErrTimeout = errors.New("IRQ error")
 
+func MakeRFID(busId, deviceId, maxSpeed, resetPin, irqPin int) (device *RFID, err error) {
+	transport, err := OpenSPI(busId, deviceId, maxSpeed)
 	if err != nil {
 		return
 	}
+	device, err = NewRFID(transport, resetPin, irqPin)
+	if device != nil {
+		device.MaxSpeedHz = maxSpeed
+	}
+	return
+}
 
-	err = spiDev.SetLSBFirst(false)
+// MakeRFIDI2C opens the reader attached to /dev/i2c-<bus> at the given address
+func MakeRFIDI2C(bus, address, resetPin, irqPin int) (device *RFID, err error) {
+	transport, err := OpenI2C(bus, address)
 	if err != nil {
-		spiDev.Close()
 		return
 	}
+	device, err = NewRFID(transport, resetPin, irqPin)
+	return
+}
 
-	err = spiDev.SetBitsPerWord(8)
-
+// MakeRFIDUART opens the reader attached to the serial port and switches
+// both sides to the given baud rate
+func MakeRFIDUART(port string, baud, resetPin, irqPin int) (device *RFID, err error) {
+	transport, err := OpenUART(port, baud)
 	if err != nil {
-		spiDev.Close()
 		return
 	}
+	device, err = NewRFID(transport, resetPin, irqPin)
+	return
+}
 
-	dev := &RFID{
-		spiDev:      spiDev,
-		MaxSpeedHz:  maxSpeed,
-		antennaGain: 4,
-		stop:        make(chan interface{}, 1),
-	}
-
-	pin, err := rpio.OpenPin(resetPin, gpio.ModeOutput)
+// NewRFID creates the reader on top of an already opened transport. The
+// transport is closed if the pins can not be opened.
+func NewRFID(transport Transport, resetPin, irqPin int) (device *RFID, err error) {
+	reset, err := rpio.OpenPin(resetPin, gpio.ModeOutput)
 	if err != nil {
-		spiDev.Close()
+		transport.Close()
 		return
 	}
-	dev.ResetPin = pin
-	dev.ResetPin.Set()
 
-	pin, err = rpio.OpenPin(irqPin, gpio.ModeInput)
+	irq, err := rpio.OpenPin(irqPin, gpio.ModeInput)
 	if err != nil {
-		spiDev.Close()
+		transport.Close()
 		return
 	}
-	dev.IrqPin = pin
-	dev.IrqPin.PullUp()
+	irq.PullUp()
+
+	device, err = NewRFIDWithPins(transport, reset, irq)
+	return
+}
+
+// NewRFIDWithPins creates the reader on top of an already opened transport
+// and pins
+func NewRFIDWithPins(transport Transport, reset, irq gpio.Pin) (device *RFID, err error) {
+	dev := &RFID{
+		ResetPin:  reset,
+		IrqPin:    irq,
+		transport: transport,
+		rfConfig:  DefaultRFConfig(),
+		stop:      make(chan interface{}, 1),
+	}
+	dev.ResetPin.Set()
 
 	err = dev.Init()
 
@@ -76,39 +113,22 @@ func MakeRFID(busId, deviceId, maxSpeed, resetPin, irqPin int) (device *RFID, er
 }
 
 func (r *RFID) Init() (err error) {
-	err = r.Reset()
-	if err != nil {
-		return
-	}
-	err = r.devWrite(0x2A, 0x8D)
-	if err != nil {
-		return
-	}
-	err = r.devWrite(0x2B, 0x3E)
-	if err != nil {
-		return
-	}
-	err = r.devWrite(0x2D, 30)
-	if err != nil {
-		return
-	}
-	err = r.devWrite(0x2C, 0)
-	if err != nil {
-		return
-	}
-	err = r.devWrite(0x15, 0x40)
-	if err != nil {
-		return
-	}
-	err = r.devWrite(0x11, 0x3D)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = r.initChip()
+	return
+}
+
+func (r *RFID) initChip() (err error) {
+	err = r.reset()
 	if err != nil {
 		return
 	}
-	err = r.devWrite(0x26, byte(r.antennaGain)<<4)
+	err = r.writeRFConfig(&r.rfConfig)
 	if err != nil {
 		return
 	}
-	err = r.SetAntenna(true)
+	err = r.setAntenna(true)
 	if err != nil {
 		return
 	}
@@ -119,53 +139,38 @@ func (r *RFID) Init() (err error) {
 func (r *RFID) Close() error {
 	r.stop <- true
 	close(r.stop)
-	return r.spiDev.Close()
-}
-
-func (r *RFID) writeSpiData(dataIn []byte) (out []byte, err error) {
-	out = make([]byte, len(dataIn))
-	copy(out, dataIn)
-	err = r.spiDev.Transfer(out)
-	return
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.transport.Close()
 }
 
 func printBytes(data []byte) (res string) {
 	res = "["
-	for _, v := range data[0 : len(data)-1] {
-		res = res + fmt.Sprintf("%02x, ", byte(v))
+	for i, v := range data {
+		if i > 0 {
+			res = res + ", "
+		}
+		res = res + fmt.Sprintf("%02x", byte(v))
 	}
-	res = res + fmt.Sprintf("%02x", data[len(data)-1])
 	res = res + "]"
 	return
 }
 
-/*
-   def dev_write(self, address, value):
-       self.spi_transfer([(address << 1) & 0x7E, value])
-*/
-
 func (r *RFID) devWrite(address int, data byte) (err error) {
-	newData := [2]byte{(byte(address) << 1) & 0x7E, data}
-	readBuf, err := r.writeSpiData(newData[:])
+	err = r.transport.WriteRegister(byte(address), data)
+	r.trace(true, address, data, err)
 	if logrus.GetLevel() == logrus.DebugLevel {
-		newData[0] = newData[0] >> 1
-		logrus.Debug(">>" + printBytes(newData[:]) + " " + printBytes(readBuf))
+		logrus.Debug(">> ", commands.RegisterName(byte(address)), " ", printBytes([]byte{data}))
 	}
 	return
 }
 
-/*
-   def dev_read(self, address):
-       return self.spi_transfer([((address << 1) & 0x7E) | 0x80, 0])[1]
-*/
 func (r *RFID) devRead(address int) (result byte, err error) {
-	data := [2]byte{((byte(address) << 1) & 0x7E) | 0x80, 0}
-	rb, err := r.writeSpiData(data[:])
+	result, err = r.transport.ReadRegister(byte(address))
+	r.trace(false, address, result, err)
 	if logrus.GetLevel() == logrus.DebugLevel {
-		data[0] = (data[0] >> 1) & 0x7f
-		logrus.Debug("<<" + printBytes(data[:]) + " " + printBytes(rb))
+		logrus.Debug("<< ", commands.RegisterName(byte(address)), " ", printBytes([]byte{result}))
 	}
-	result = rb[1]
 	return
 }
 
@@ -210,15 +215,47 @@ func (r *RFID) clearBitmask(address, mask int) (err error) {
        if 0 <= gain <= 7:
            self.antenna_gain = gain
 */
-func (r *RFID) SetAntennaGain(gain int) {
-	if 0 <= gain && gain <= 7 {
-		r.antennaGain = gain
+// SetAntennaGain writes the receiver gain to the chip right away, it is
+// kept for the subsequent calls to Init()
+func (r *RFID) SetAntennaGain(gain int) (err error) {
+	if gain < 0 || gain > 7 {
+		err = errors.New(fmt.Sprintf("antenna gain out of range: %d", gain))
+		return
 	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c := r.rfConfig
+	c.RxGain = RxGain(gain)
+	err = r.applyRFConfig(c)
+	return
+}
+
+// Authenticated reports whether the last authentication succeeded and the
+// crypto unit wasn't stopped since
+func (r *RFID) Authenticated() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.authenticated
 }
 
 func (r *RFID) Reset() (err error) {
-	r.Authenticated = false
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = r.reset()
+	return
+}
+
+func (r *RFID) reset() (err error) {
+	r.authenticated = false
 	err = r.devWrite(commands.CommandReg, commands.PCD_RESETPHASE)
+	if err != nil {
+		return
+	}
+	if t, ok := r.transport.(resyncer); ok {
+		// soft reset restores the default host interface settings
+		time.Sleep(50 * time.Millisecond)
+		err = t.resync()
+	}
 	return
 }
 
@@ -233,6 +270,13 @@ func (r *RFID) Reset() (err error) {
 
 */
 func (r *RFID) SetAntenna(state bool) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = r.setAntenna(state)
+	return
+}
+
+func (r *RFID) setAntenna(state bool) (err error) {
 	if state {
 		current, err := r.devRead(commands.TxControlReg)
 		logrus.Debug("Antenna", current)
@@ -305,8 +349,8 @@ func (r *RFID) cardWrite(command byte, data []byte) (backData []byte, backLength
 	}
 
 	if n&irqEn&0x01 == 1 {
-		logrus.Error("E1")
-		err = errors.New("IRQ error")
+		logrus.Debug("E1")
+		err = ErrTimeout
 		return
 	}
 
@@ -350,6 +394,13 @@ func (r *RFID) cardWrite(command byte, data []byte) (backData []byte, backLength
 }
 
 func (r *RFID) Request() (backBits int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	backBits, err = r.request()
+	return
+}
+
+func (r *RFID) request() (backBits int, err error) {
 	backBits = 0
 	err = r.devWrite(commands.BitFramingReg, 0x07)
 	if err != nil {
@@ -358,7 +409,7 @@ func (r *RFID) Request() (backBits int, err error) {
 
 	_, backBits, err = r.cardWrite(commands.PCD_TRANSCEIVE, []byte{0x26}[:])
 
-	logrus.Info(err, backBits)
+	logrus.Debug(err, backBits)
 
 	if backBits != 0x10 {
 		err = errors.New(fmt.Sprintf("wrong number of bits %d", backBits))
@@ -368,6 +419,9 @@ func (r *RFID) Request() (backBits int, err error) {
 }
 
 func (r *RFID) Wait() (err error) {
+	r.waitMu.Lock()
+	defer r.waitMu.Unlock()
+
 	irqChannel := make(chan bool)
 	r.IrqPin.BeginWatch(gpio.EdgeFalling, func() {
 		defer func() {
@@ -383,31 +437,36 @@ func (r *RFID) Wait() (err error) {
 		close(irqChannel)
 	}()
 
-	err = r.Init()
-	if err != nil {
-		return
-	}
-	err = r.devWrite(commands.CommIrqReg, 0x00)
-	if err != nil {
+	err = r.locked(func() (err error) {
+		err = r.initChip()
+		if err != nil {
+			return
+		}
+		err = r.devWrite(commands.CommIrqReg, 0x00)
+		if err != nil {
+			return
+		}
+		err = r.devWrite(commands.CommIEnReg, 0xA0)
 		return
-	}
-	err = r.devWrite(commands.CommIEnReg, 0xA0)
+	})
 	if err != nil {
 		return
 	}
-	logrus.SetLevel(logrus.ErrorLevel)
 
 interruptLoop:
 	for {
-		err = r.devWrite(commands.FIFODataReg, 0x26)
-		if err != nil {
-			return
-		}
-		err = r.devWrite(commands.CommandReg, 0x0C)
-		if err != nil {
+		err = r.locked(func() (err error) {
+			err = r.devWrite(commands.FIFODataReg, 0x26)
+			if err != nil {
+				return
+			}
+			err = r.devWrite(commands.CommandReg, 0x0C)
+			if err != nil {
+				return
+			}
+			err = r.devWrite(commands.BitFramingReg, 0x87)
 			return
-		}
-		err = r.devWrite(commands.BitFramingReg, 0x87)
+		})
 		if err != nil {
 			return
 		}
@@ -423,7 +482,66 @@ interruptLoop:
 	return
 }
 
+func (r *RFID) locked(f func() error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return f()
+}
+
+// ReadUID detects a card in the field without waiting for the IRQ and
+// returns its 4 byte serial number
+func (r *RFID) ReadUID() (uid []byte, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	uid, err = r.readUID()
+	return
+}
+
+func (r *RFID) readUID() (uid []byte, err error) {
+	_, err = r.request()
+	if err != nil {
+		return
+	}
+	serial, err := r.antiColl()
+	if err != nil {
+		return
+	}
+	uid = serial[:4]
+	return
+}
+
+// Halt puts the selected card into the HALT state, so it doesn't answer
+// the subsequent requests until it leaves the field
+func (r *RFID) Halt() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = r.halt()
+	return
+}
+
+func (r *RFID) halt() (err error) {
+	buf := []byte{commands.PICC_HALT, 0x00}
+	crc, err := r.crc(buf)
+	if err != nil {
+		return
+	}
+	buf = append(buf, crc...)
+	_, _, err = r.cardWrite(commands.PCD_TRANSCEIVE, buf)
+	// the card never answers HLTA
+	if err == ErrTimeout {
+		err = nil
+	}
+	return
+}
+
 func (r *RFID) AntiColl() (backData []byte, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	backData, err = r.antiColl()
+	return
+}
+
+func (r *RFID) antiColl() (backData []byte, err error) {
 
 	err = r.devWrite(commands.BitFramingReg, 0x00)
 
@@ -455,6 +573,13 @@ func (r *RFID) AntiColl() (backData []byte, err error) {
 }
 
 func (r *RFID) CRC(inData []byte) (res []byte, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	res, err = r.crc(inData)
+	return
+}
+
+func (r *RFID) crc(inData []byte) (res []byte, err error) {
 	res = []byte{0, 0}
 	err = r.clearBitmask(commands.DivIrqReg, 0x04)
 	if err != nil {
@@ -496,11 +621,18 @@ func (r *RFID) CRC(inData []byte) (res []byte, err error) {
 }
 
 func (r *RFID) SelectTag(serial []byte) (blocks byte, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	blocks, err = r.selectTag(serial)
+	return
+}
+
+func (r *RFID) selectTag(serial []byte) (blocks byte, err error) {
 	dataBuf := make([]byte, len(serial)+2)
 	dataBuf[0] = commands.PICC_SElECTTAG
 	dataBuf[1] = 0x70
 	copy(dataBuf[2:], serial)
-	crc, err := r.CRC(dataBuf)
+	crc, err := r.crc(dataBuf)
 	if err != nil {
 		return
 	}
@@ -547,15 +679,26 @@ func (r *RFID) auth(mode byte, blockAddress byte, sectorKey []byte, serial []byt
 		logrus.Warn("Can not read device status register")
 		return
 	}
-	if n&0x08 != 0 {
+	// MFCrypto1On is set by a successful authentication only
+	if n&0x08 == 0 {
 		logrus.Debug("N is ", n)
 		authS = AuthFailure
+		return
 	}
 	authS = AuthOk
+	r.authenticated = true
 	return
 }
 
 func (r *RFID) StopCrypto() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	err = r.stopCrypto()
+	return
+}
+
+func (r *RFID) stopCrypto() (err error) {
+	r.authenticated = false
 	err = r.clearBitmask(commands.Status2Reg, 0x08)
 	return
 }
@@ -565,7 +708,7 @@ func (r *RFID) preAccess(blockAddr byte, cmd byte) (data []byte, backLen int, er
 	send[0] = cmd
 	send[1] = blockAddr
 
-	crc, err := r.CRC(send[:2])
+	crc, err := r.crc(send[:2])
 	if err != nil {
 		return
 	}
@@ -592,6 +735,9 @@ func (r *RFID) write(blockAddr byte, data []byte) (err error) {
 	read, backLen, err := r.preAccess(blockAddr, commands.PICC_WRITE)
 	if err != nil || backLen != 4 {
 		logrus.Warn("Can not grant Write to block ", read, backLen, err)
+		if err == nil {
+			err = errors.New(fmt.Sprintf("can not grant write to block %d", blockAddr))
+		}
 		return
 	}
 	if read[0]&0x0F != 0x0A {
@@ -600,7 +746,7 @@ func (r *RFID) write(blockAddr byte, data []byte) (err error) {
 	}
 	newData := make([]byte, 18)
 	copy(newData, data[:16])
-	crc, err := r.CRC(newData[:16])
+	crc, err := r.crc(newData[:16])
 	if err != nil {
 		logrus.Warn("Can't calculate CRC")
 		return
@@ -623,77 +769,59 @@ func calcBlockAddress(sector int, block int) (addr byte) {
 }
 
 func (r *RFID) ReadBlock(sector int, block int) (res []byte, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	res, err = r.read(calcBlockAddress(sector, block%3))
 	return
 }
 
 func (r *RFID) WriteBlock(auth byte, sector int, block int, data [16]byte, key []byte) (err error) {
-	defer func() {
-		r.StopCrypto()
-	}()
-	uuid, err := r.selectCard()
-	if err != nil {
+	err = r.withSession(auth, key, func(s *sectorSession) (err error) {
+		err = s.enter(sector)
+		if err != nil {
+			return
+		}
+		err = r.write(calcBlockAddress(sector, block%3), data[:])
 		return
-	}
-	state, err := r.Auth(auth, sector, 3, key, uuid)
-	if err != nil || state != AuthOk {
-		logrus.Fatal("Can not authenticate ", err, " => ", state)
-	}
-
-	err = r.write(calcBlockAddress(sector, block%3), data[:])
+	})
 	return
 }
 
 func (r *RFID) ReadSectorTrail(sector int) (res []byte, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	res, err = r.read(calcBlockAddress(sector&0xFF, 3))
 	return
 }
 
 func (r *RFID) WriteSectorTrail(auth byte, sector int, keyA [6]byte, keyB [6]byte, access *BlocksAccess, key []byte) (err error) {
-	defer func() {
-		r.StopCrypto()
-	}()
-	uuid, err := r.selectCard()
-	if err != nil {
-		return
-	}
-	state, err := r.Auth(auth, sector, 3, key, uuid)
-	if err != nil || state != AuthOk {
-		logrus.Fatal("Can not authenticate ", err, " => ", state)
-	}
-
-	data := make([]byte, 16)
-	copy(data, keyA[:])
-	accessData := CalculateBlockAccess(access)
-	copy(data[6:], accessData[:4])
-	copy(data[10:], keyB[:])
-	err = r.write(calcBlockAddress(sector&0xFF, 3), data)
+	err = r.withSession(auth, key, func(s *sectorSession) error {
+		return s.writeSectorTrail(sector, keyA, keyB, access)
+	})
 	return
 }
 
 func (r *RFID) Auth(mode byte, sector int, block int, sectorKey []byte, serial []byte) (authS AuthStatus, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	authS, err = r.auth(mode, calcBlockAddress(sector, block), sectorKey, serial)
 	return
 }
 
 func (r *RFID) selectCard() (uuid []byte, err error) {
-	err = r.Wait()
-	if err != nil {
-		return
-	}
-	err = r.Init()
+	err = r.initChip()
 	if err != nil {
 		return
 	}
-	_, err = r.Request()
+	_, err = r.request()
 	if err != nil {
 		return
 	}
-	uuid, err = r.AntiColl()
+	uuid, err = r.antiColl()
 	if err != nil {
 		return
 	}
-	_, err = r.SelectTag(uuid)
+	_, err = r.selectTag(uuid)
 	if err != nil {
 		return
 	}
@@ -701,37 +829,26 @@ func (r *RFID) selectCard() (uuid []byte, err error) {
 }
 
 func (r *RFID) ReadCard(auth byte, sector int, block int, key []byte) (data []byte, err error) {
-	defer func() {
-		r.StopCrypto()
-	}()
-	uuid, err := r.selectCard()
-	if err != nil {
+	err = r.withSession(auth, key, func(s *sectorSession) (err error) {
+		err = s.enter(sector)
+		if err != nil {
+			return
+		}
+		data, err = r.read(calcBlockAddress(sector, block%3))
 		return
-	}
-	state, err := r.Auth(auth, sector, block, key, uuid)
-	if err != nil || state != AuthOk {
-		logrus.Fatal("Can not authenticate ", err, " => ", state)
-	}
-
-	data, err = r.ReadBlock(sector, block)
-
+	})
 	return
 }
 
 func (r *RFID) ReadAuth(auth byte, sector int, key []byte) (data []byte, err error) {
-	defer func() {
-		r.StopCrypto()
-	}()
-	uuid, err := r.selectCard()
-	if err != nil {
+	err = r.withSession(auth, key, func(s *sectorSession) (err error) {
+		err = s.enter(sector)
+		if err != nil {
+			return
+		}
+		data, err = r.read(calcBlockAddress(sector, 3))
 		return
-	}
-	state, err := r.Auth(auth, sector, 3, key, uuid)
-	if err != nil || state != AuthOk {
-		logrus.Fatal("Can not authenticate ", err, " => ", state)
-	}
-
-	data, err = r.read(calcBlockAddress(sector, 3))
+	})
 	return
 }
 
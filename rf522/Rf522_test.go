@@ -3,7 +3,9 @@ package rf522
 import (
 	"fmt"
 	"github.com/stretchr/testify/assert"
+	"runtime"
 	"strconv"
+	"sync"
 	"testing"
 )
 
@@ -47,3 +49,69 @@ func TestBitCalc(t *testing.T) {
 	fmt.Println("Access for FF0780 is", *ParseBlockAccess([]byte{0x80, 0x07, 0xff}))
 
 }
+
+// registerFile is a Transport backed by plain memory
+type registerFile struct {
+	sync.Mutex
+	regs [64]byte
+}
+
+func (f *registerFile) ReadRegister(address byte) (byte, error) {
+	f.Lock()
+	defer f.Unlock()
+	return f.regs[address&0x3F], nil
+}
+
+func (f *registerFile) WriteRegister(address byte, value byte) error {
+	f.Lock()
+	f.regs[address&0x3F] = value
+	f.Unlock()
+	runtime.Gosched()
+	return nil
+}
+
+func (f *registerFile) Close() error {
+	return nil
+}
+
+func TestConcurrentConfig(t *testing.T) {
+	chip := new(registerFile)
+	r := &RFID{transport: chip}
+
+	a := DefaultRFConfig()
+	b := DefaultRFConfig()
+	b.RxGain = RxGain48dB
+	b.CWGsP = 0x3F
+	b.MinLevel = 0x0F
+	b.Timer.Reload = 0x0400
+
+	assert.NoError(t, r.ApplyRFConfig(a))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(c RFConfig) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				assert.NoError(t, r.ApplyRFConfig(c))
+			}
+		}([]RFConfig{a, b}[i%2])
+	}
+	done := make(chan interface{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		active, err := r.ReadRFConfig()
+		assert.NoError(t, err)
+		if !assert.True(t, active == a || active == b, "configuration is mixed up: %+v", active) {
+			return
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package rf522
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/sirupsen/logrus"
+)
+
+// The sector operations assume the MIFARE Classic 1K layout: 16 sectors of
+// 4 blocks, the last block of every sector is the sector trailer.
+const (
+	SectorCount     = 16
+	BlocksPerSector = 4
+)
+
+// BlockData is the content of a single block addressed by its absolute
+// number, i.e. sector*4+block
+type BlockData struct {
+	Address int
+	Data    [16]byte
+}
+
+// AuthError is returned when the card rejects the key for a sector
+type AuthError struct {
+	Sector int
+	Status AuthStatus
+}
+
+func (e *AuthError) Error() string {
+	return fmt.Sprintf("can not authenticate sector %d, status %d", e.Sector, e.Status)
+}
+
+// sectorSession keeps the authentication to the last sector of the selected
+// card, so consecutive blocks of the same sector are accessed with a single
+// authentication
+type sectorSession struct {
+	r      *RFID
+	mode   byte
+	key    []byte
+	uuid   []byte
+	sector int
+	// dropped is set when the card refused a key, it left the selected
+	// state and has to be selected again
+	dropped bool
+}
+
+// use switches to another key, the next access authenticates again
+func (s *sectorSession) use(mode byte, key []byte) {
+	if mode != s.mode || !bytes.Equal(key, s.key) {
+		s.mode, s.key = mode, append([]byte{}, key...)
+		s.sector = -1
+	}
+}
+
+// reselect wakes the card up after a refused key, it must be the same card
+func (s *sectorSession) reselect() (err error) {
+	if err = s.r.stopCrypto(); err != nil {
+		return
+	}
+	if err = s.r.devWrite(commands.BitFramingReg, 0x07); err != nil {
+		return
+	}
+	_, bits, err := s.r.cardWrite(commands.PCD_TRANSCEIVE, []byte{commands.PICC_REQALL})
+	if err != nil {
+		return
+	}
+	if bits != 0x10 {
+		err = errors.New(fmt.Sprintf("wrong number of bits %d", bits))
+		return
+	}
+	serial, err := s.r.antiColl()
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(serial, s.uuid) {
+		err = errors.New(fmt.Sprintf("card %X replaced by %X", s.uuid[:4], serial[:4]))
+		return
+	}
+	if _, err = s.r.selectTag(serial); err != nil {
+		return
+	}
+	s.dropped = false
+	return
+}
+
+func (s *sectorSession) enter(sector int) (err error) {
+	if sector == s.sector {
+		return
+	}
+	if s.dropped {
+		if err = s.reselect(); err != nil {
+			return
+		}
+	}
+	state, err := s.r.auth(s.mode, calcBlockAddress(sector, 3), s.key, s.uuid)
+	if err == nil && state != AuthOk {
+		err = &AuthError{Sector: sector, Status: state}
+	}
+	if err != nil {
+		logrus.Warn("Can not authenticate ", err, " => ", state)
+		s.sector = -1
+		s.dropped = true
+		return
+	}
+	s.sector = sector
+	return
+}
+
+func (s *sectorSession) readBlocks(blocks []int) (data [][]byte, err error) {
+	result := make([][]byte, 0, len(blocks))
+	for _, addr := range blocks {
+		err = s.enter(addr / BlocksPerSector)
+		if err != nil {
+			return
+		}
+		block, err := s.r.read(byte(addr))
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, block)
+	}
+	data = result
+	return
+}
+
+func (s *sectorSession) writeBlocks(blocks []BlockData) (err error) {
+	for _, b := range blocks {
+		err = s.enter(b.Address / BlocksPerSector)
+		if err != nil {
+			return
+		}
+		err = s.r.write(byte(b.Address), b.Data[:])
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (s *sectorSession) writeSectorTrail(sector int, keyA [6]byte, keyB [6]byte, access *BlocksAccess) (err error) {
+	err = s.enter(sector)
+	if err != nil {
+		return
+	}
+	data := make([]byte, 16)
+	copy(data, keyA[:])
+	accessData := CalculateBlockAccess(access)
+	copy(data[6:], accessData[:4])
+	copy(data[10:], keyB[:])
+	err = s.r.write(calcBlockAddress(sector&0xFF, 3), data)
+	return
+}
+
+// withSession waits for the card, selects it and runs f while holding the
+// reader lock. The crypto unit is stopped afterwards.
+func (r *RFID) withSession(mode byte, key []byte, f func(s *sectorSession) error) (err error) {
+	err = r.Wait()
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer func() {
+		r.stopCrypto()
+	}()
+	uuid, err := r.selectCard()
+	if err != nil {
+		return
+	}
+	err = f(&sectorSession{r: r, mode: mode, key: key, uuid: uuid, sector: -1})
+	return
+}
+
+func checkBlockAddress(addr int) (err error) {
+	if addr < 0 || addr >= SectorCount*BlocksPerSector {
+		err = errors.New(fmt.Sprintf("block address %d is out of range", addr))
+	}
+	return
+}
+
+func checkReadBlocks(blocks []int) (err error) {
+	for _, addr := range blocks {
+		if err = checkBlockAddress(addr); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func checkWriteBlocks(blocks []BlockData) (err error) {
+	for _, b := range blocks {
+		if err = checkBlockAddress(b.Address); err != nil {
+			return
+		}
+		if b.Address%BlocksPerSector == 3 {
+			err = errors.New(fmt.Sprintf("block %d is a sector trailer", b.Address))
+			return
+		}
+	}
+	return
+}
+
+// ReadSector reads all the blocks of the sector, including the trailer,
+// with a single authentication
+func (r *RFID) ReadSector(auth byte, sector int, key []byte) (data [][]byte, err error) {
+	blocks := make([]int, BlocksPerSector)
+	for i := range blocks {
+		blocks[i] = sector*BlocksPerSector + i
+	}
+	data, err = r.ReadBlocks(auth, blocks, key)
+	return
+}
+
+// WriteSector writes the three data blocks of the sector with a single
+// authentication. Block 0 of sector 0 holds the manufacturer data and can't
+// be written on genuine cards.
+func (r *RFID) WriteSector(auth byte, sector int, data [3][16]byte, key []byte) (err error) {
+	blocks := make([]BlockData, len(data))
+	for i, v := range data {
+		blocks[i] = BlockData{Address: sector*BlocksPerSector + i, Data: v}
+	}
+	err = r.WriteBlocks(auth, blocks, key)
+	return
+}
+
+// ReadBlocks reads the blocks in the given order, authenticating again only
+// when the next block belongs to another sector. All the sectors must be
+// accessible with the same key.
+func (r *RFID) ReadBlocks(auth byte, blocks []int, key []byte) (data [][]byte, err error) {
+	if err = checkReadBlocks(blocks); err != nil {
+		return
+	}
+	err = r.withSession(auth, key, func(s *sectorSession) (err error) {
+		data, err = s.readBlocks(blocks)
+		return
+	})
+	return
+}
+
+// WriteBlocks writes the blocks in the given order, authenticating again
+// only when the next block belongs to another sector. Sector trailers are
+// refused, use WriteSectorTrail for them.
+func (r *RFID) WriteBlocks(auth byte, blocks []BlockData, key []byte) (err error) {
+	if err = checkWriteBlocks(blocks); err != nil {
+		return
+	}
+	err = r.withSession(auth, key, func(s *sectorSession) error {
+		return s.writeBlocks(blocks)
+	})
+	return
+}
+
+// CardSession is a card selected once for several operations, see WithCard
+type CardSession struct {
+	s *sectorSession
+}
+
+// WithCard waits for a card, selects it and runs f while holding the reader
+// lock, every operation of f goes to that card. When the card refuses a
+// key it is selected again for the next operation, which fails if another
+// card answers.
+func (r *RFID) WithCard(f func(c *CardSession) error) (err error) {
+	err = r.withSession(0, nil, func(s *sectorSession) error {
+		return f(&CardSession{s: s})
+	})
+	return
+}
+
+// UID returns the 4 byte serial number of the card
+func (c *CardSession) UID() []byte {
+	return append([]byte{}, c.s.uuid[:4]...)
+}
+
+// ReadBlocks works as RFID.ReadBlocks on the card of the session
+func (c *CardSession) ReadBlocks(auth byte, blocks []int, key []byte) (data [][]byte, err error) {
+	if err = checkReadBlocks(blocks); err != nil {
+		return
+	}
+	c.s.use(auth, key)
+	data, err = c.s.readBlocks(blocks)
+	return
+}
+
+// WriteBlocks works as RFID.WriteBlocks on the card of the session
+func (c *CardSession) WriteBlocks(auth byte, blocks []BlockData, key []byte) (err error) {
+	if err = checkWriteBlocks(blocks); err != nil {
+		return
+	}
+	c.s.use(auth, key)
+	err = c.s.writeBlocks(blocks)
+	return
+}
+
+// WriteSectorTrail works as RFID.WriteSectorTrail on the card of the session
+func (c *CardSession) WriteSectorTrail(auth byte, sector int, keyA [6]byte, keyB [6]byte, access *BlocksAccess, key []byte) (err error) {
+	c.s.use(auth, key)
+	err = c.s.writeSectorTrail(sector, keyA, keyB, access)
+	return
+}
@@ -0,0 +1,95 @@
+package rf522
+
+import (
+	"testing"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadBlocksAuthenticatesOncePerSector(t *testing.T) {
+	card := newClassicCard([]byte{0xDE, 0xAD, 0xBE, 0xEF})
+	card.blocks[4][0] = 0x11
+	card.blocks[6][15] = 0x22
+	card.blocks[9][1] = 0x33
+	r, _ := newFakeRFID(card)
+
+	data, err := r.ReadBlocks(commands.PICC_AUTHENT1A, []int{4, 5, 6, 9, 10}, DefaultKey)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, card.auths)
+	assert.Len(t, data, 5)
+	assert.Equal(t, byte(0x11), data[0][0])
+	assert.Equal(t, byte(0x22), data[2][15])
+	assert.Equal(t, byte(0x33), data[3][1])
+	assert.False(t, r.Authenticated())
+}
+
+func TestReadSector(t *testing.T) {
+	card := newClassicCard([]byte{1, 2, 3, 4})
+	r, _ := newFakeRFID(card)
+
+	data, err := r.ReadSector(commands.PICC_AUTHENT1A, 2, DefaultKey)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, card.auths)
+	assert.Len(t, data, 4)
+	assert.Equal(t, card.blocks[11][:], data[3])
+
+	_, err = r.ReadSector(commands.PICC_AUTHENT1A, 2, []byte{1, 2, 3, 4, 5, 6})
+	assert.Error(t, err)
+}
+
+func TestWriteSector(t *testing.T) {
+	card := newClassicCard([]byte{1, 2, 3, 4})
+	r, _ := newFakeRFID(card)
+
+	var data [3][16]byte
+	for i := range data {
+		for j := range data[i] {
+			data[i][j] = byte(i*16 + j)
+		}
+	}
+	assert.NoError(t, r.WriteSector(commands.PICC_AUTHENT1B, 5, data, DefaultKey))
+	assert.Equal(t, 1, card.auths)
+	assert.Equal(t, data[0], card.blocks[20])
+	assert.Equal(t, data[2], card.blocks[22])
+
+	assert.Error(t, r.WriteBlocks(commands.PICC_AUTHENT1A, []BlockData{{Address: 23}}, DefaultKey))
+}
+
+func TestWithCard(t *testing.T) {
+	card := newClassicCard([]byte{1, 2, 3, 4})
+	copy(card.blocks[7][0:6], []byte{0xA0, 0xA1, 0xA2, 0xA3, 0xA4, 0xA5})
+	card.blocks[4][0] = 0x11
+	r, _ := newFakeRFID(card)
+
+	err := r.WithCard(func(c *CardSession) (err error) {
+		assert.Equal(t, []byte{1, 2, 3, 4}, c.UID())
+		_, err = c.ReadBlocks(commands.PICC_AUTHENT1A, []int{4}, DefaultKey)
+		assert.IsType(t, &AuthError{}, err)
+		data, err := c.ReadBlocks(commands.PICC_AUTHENT1A, []int{4}, []byte{0xA0, 0xA1, 0xA2, 0xA3, 0xA4, 0xA5})
+		if err != nil {
+			return
+		}
+		assert.Equal(t, byte(0x11), data[0][0])
+		return c.WriteBlocks(commands.PICC_AUTHENT1A, []BlockData{{Address: 8, Data: [16]byte{0x22}}}, DefaultKey)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x22), card.blocks[8][0])
+	assert.False(t, r.Authenticated())
+}
+
+func TestWithCardReplaced(t *testing.T) {
+	card := newClassicCard([]byte{1, 2, 3, 4})
+	other := newClassicCard([]byte{5, 6, 7, 8})
+	r, chip := newFakeRFID(card)
+
+	err := r.WithCard(func(c *CardSession) (err error) {
+		_, err = c.ReadBlocks(commands.PICC_AUTHENT1A, []int{4}, []byte{1, 2, 3, 4, 5, 6})
+		assert.Error(t, err)
+		chip.card = other
+		return c.WriteBlocks(commands.PICC_AUTHENT1A, []BlockData{{Address: 8, Data: [16]byte{0x22}}}, DefaultKey)
+	})
+	assert.Error(t, err)
+	assert.Equal(t, 0, other.auths)
+	assert.Equal(t, [16]byte{}, other.blocks[8])
+}
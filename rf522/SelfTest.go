@@ -0,0 +1,142 @@
+package rf522
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+)
+
+// Chip versions reported by VersionReg
+const (
+	VersionMFRC522v1 = 0x91
+	VersionMFRC522v2 = 0x92
+)
+
+// selfTestReference is the FIFO content after the digital self test, see
+// section 16.1 of the MFRC522 datasheet
+var selfTestReference = map[byte][]byte{
+	VersionMFRC522v1: {
+		0x00, 0xC6, 0x37, 0xD5, 0x32, 0xB7, 0x57, 0x5C,
+		0xC2, 0xD8, 0x7C, 0x4D, 0xD9, 0x70, 0xC7, 0x73,
+		0x10, 0xE6, 0xD2, 0xAA, 0x5E, 0xA1, 0x3E, 0x5A,
+		0x14, 0xAF, 0x30, 0x61, 0xC9, 0x70, 0xDB, 0x2E,
+		0x64, 0x22, 0x72, 0xB5, 0xBD, 0x65, 0xF4, 0xEC,
+		0x22, 0xBC, 0xD3, 0x72, 0x35, 0xCD, 0xAA, 0x41,
+		0x1F, 0xA7, 0xF3, 0x53, 0x14, 0xDE, 0x7E, 0x02,
+		0xD9, 0x0F, 0xB5, 0x5E, 0x25, 0x1D, 0x29, 0x79,
+	},
+	VersionMFRC522v2: {
+		0x00, 0xEB, 0x66, 0xBA, 0x57, 0xBF, 0x23, 0x95,
+		0xD0, 0xE3, 0x0D, 0x3D, 0x27, 0x89, 0x5C, 0xDE,
+		0x9D, 0x3B, 0xA7, 0x00, 0x21, 0x5B, 0x89, 0x82,
+		0x51, 0x3A, 0xEB, 0x02, 0x0C, 0xA5, 0x00, 0x49,
+		0x7C, 0x84, 0x4D, 0xB3, 0xCC, 0xD2, 0x1B, 0x81,
+		0x5D, 0x48, 0x76, 0xD5, 0x71, 0x61, 0x21, 0xA9,
+		0x86, 0x96, 0x83, 0x38, 0xCF, 0x9D, 0x5B, 0x6D,
+		0xDC, 0x15, 0xBA, 0x3E, 0x7D, 0x95, 0x3B, 0x2F,
+	},
+}
+
+// Version returns the content of VersionReg
+func (r *RFID) Version() (version byte, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	version, err = r.devRead(commands.VersionReg)
+	return
+}
+
+// SelfTest runs the digital self test of the chip and compares the result
+// with the reference for the chip version. The chip is initialized again
+// afterwards.
+func (r *RFID) SelfTest() (version byte, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	version, err = r.devRead(commands.VersionReg)
+	if err != nil {
+		return
+	}
+	reference, ok := selfTestReference[version]
+	if !ok {
+		err = errors.New(fmt.Sprintf("no self test reference for version 0x%02X", version))
+		return
+	}
+	result, err := r.selfTest()
+	if err1 := r.initChip(); err == nil {
+		err = err1
+	}
+	if err != nil {
+		return
+	}
+	if !bytes.Equal(result, reference) {
+		err = errors.New(fmt.Sprintf("self test failed: %s", printBytes(result)))
+	}
+	return
+}
+
+func (r *RFID) selfTest() (result []byte, err error) {
+	err = r.reset()
+	if err != nil {
+		return
+	}
+	// clear the internal buffer
+	err = r.devWrite(commands.FIFOLevelReg, 0x80)
+	if err != nil {
+		return
+	}
+	for i := 0; i < 25; i++ {
+		if err = r.devWrite(commands.FIFODataReg, 0x00); err != nil {
+			return
+		}
+	}
+	err = r.devWrite(commands.CommandReg, commands.PCD_MEM)
+	if err != nil {
+		return
+	}
+	err = r.devWrite(commands.AutoTestReg, 0x09)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err1 := r.devWrite(commands.AutoTestReg, 0x00); err == nil {
+			err = err1
+		}
+	}()
+	err = r.devWrite(commands.FIFODataReg, 0x00)
+	if err != nil {
+		return
+	}
+	err = r.devWrite(commands.CommandReg, commands.PCD_CALCCRC)
+	if err != nil {
+		return
+	}
+	deadline := time.Now().Add(100 * time.Millisecond)
+	for {
+		n, err1 := r.devRead(commands.FIFOLevelReg)
+		if err1 != nil {
+			err = err1
+			return
+		}
+		if n >= FIFOSize {
+			break
+		}
+		if time.Now().After(deadline) {
+			err = errors.New(fmt.Sprintf("self test produced %d bytes only", n))
+			return
+		}
+	}
+	err = r.devWrite(commands.CommandReg, commands.PCD_IDLE)
+	if err != nil {
+		return
+	}
+	result = make([]byte, FIFOSize)
+	for i := range result {
+		result[i], err = r.devRead(commands.FIFODataReg)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
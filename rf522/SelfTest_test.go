@@ -0,0 +1,36 @@
+package rf522
+
+import (
+	"testing"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelfTest(t *testing.T) {
+	r, chip := newFakeRFID(nil)
+	chip.regs[commands.VersionReg] = VersionMFRC522v2
+	chip.self = selfTestReference[VersionMFRC522v2]
+
+	version, err := r.SelfTest()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(VersionMFRC522v2), version)
+	assert.Equal(t, byte(0), chip.regs[commands.AutoTestReg])
+
+	chip.regs[commands.VersionReg] = VersionMFRC522v1
+	_, err = r.SelfTest()
+	assert.Error(t, err, "v1 reference must not match v2 output")
+
+	chip.regs[commands.VersionReg] = 0x12
+	_, err = r.SelfTest()
+	assert.Error(t, err)
+}
+
+func TestVersion(t *testing.T) {
+	r, chip := newFakeRFID(nil)
+	chip.regs[commands.VersionReg] = VersionMFRC522v1
+	version, err := r.Version()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(VersionMFRC522v1), version)
+	assert.Empty(t, chip.sent, "nothing is sent to the card")
+}
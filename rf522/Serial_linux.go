@@ -0,0 +1,89 @@
+package rf522
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"unsafe"
+)
+
+// TCFLSH is missing from the syscall package
+const tcflsh = 0x540B
+
+var termiosSpeeds = map[int]uint32{
+	9600:   syscall.B9600,
+	19200:  syscall.B19200,
+	38400:  syscall.B38400,
+	57600:  syscall.B57600,
+	115200: syscall.B115200,
+	230400: syscall.B230400,
+	460800: syscall.B460800,
+	921600: syscall.B921600,
+}
+
+// termiosPort is a raw 8N1 serial port with a 500ms read timeout
+type termiosPort struct {
+	fd int
+}
+
+func openSerial(name string, baud int) (p *termiosPort, err error) {
+	fd, err := syscall.Open(name, syscall.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return
+	}
+	port := &termiosPort{fd: fd}
+	err = port.setBaud(baud)
+	if err != nil {
+		syscall.Close(fd)
+		return
+	}
+	p = port
+	return
+}
+
+func (p *termiosPort) ioctl(req uintptr, arg uintptr) (err error) {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(p.fd), req, arg)
+	if errno != 0 {
+		err = errno
+	}
+	return
+}
+
+func (p *termiosPort) setBaud(baud int) (err error) {
+	speed, ok := termiosSpeeds[baud]
+	if !ok {
+		err = errors.New(fmt.Sprintf("unsupported baud rate %d", baud))
+		return
+	}
+	t := syscall.Termios{
+		Cflag:  syscall.CS8 | syscall.CREAD | syscall.CLOCAL | speed,
+		Ispeed: speed,
+		Ospeed: speed,
+	}
+	t.Cc[syscall.VMIN] = 0
+	t.Cc[syscall.VTIME] = 5
+	err = p.ioctl(syscall.TCSETS, uintptr(unsafe.Pointer(&t)))
+	if err != nil {
+		return
+	}
+	err = p.ioctl(tcflsh, syscall.TCIOFLUSH)
+	return
+}
+
+func (p *termiosPort) Read(buf []byte) (n int, err error) {
+	n, err = syscall.Read(p.fd, buf)
+	if err == nil && n == 0 {
+		err = io.EOF
+	}
+	return
+}
+
+func (p *termiosPort) Write(buf []byte) (n int, err error) {
+	n, err = syscall.Write(p.fd, buf)
+	return
+}
+
+func (p *termiosPort) Close() error {
+	return syscall.Close(p.fd)
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package rf522
+
+import "errors"
+
+func openSerial(name string, baud int) (p serialPort, err error) {
+	err = errors.New("UART transport is only supported on Linux")
+	return
+}
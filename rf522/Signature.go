@@ -0,0 +1,95 @@
+package rf522
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+)
+
+func hexInt(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("bad hex number " + s)
+	}
+	return v
+}
+
+// secp128r1 is the curve of the NXP originality signature. Its a = p-3, so
+// the generic implementation of crypto/elliptic applies.
+var secp128r1 = &elliptic.CurveParams{
+	Name:    "secp128r1",
+	P:       hexInt("FFFFFFFDFFFFFFFFFFFFFFFFFFFFFFFF"),
+	N:       hexInt("FFFFFFFE0000000075A30D1B9038A115"),
+	B:       hexInt("E87579C11079F43DD824993C2CEE5ED3"),
+	Gx:      hexInt("161FF7528B899B2D0C28607CA52C5B86"),
+	Gy:      hexInt("CF5AC8395BAFEB13C02DA292DDED7A83"),
+	BitSize: 128,
+}
+
+func publicKey(x, y string) *ecdsa.PublicKey {
+	return &ecdsa.PublicKey{Curve: secp128r1, X: hexInt(x), Y: hexInt(y)}
+}
+
+// OriginalityKeys are the public keys NXP signs the UIDs of NTAG21x and
+// Ultralight EV1 tags with
+var OriginalityKeys = []*ecdsa.PublicKey{
+	// NTAG21x
+	publicKey("494E1A386D3D3CFE3DC10E5DE68A499B", "1C202DB5B132393E89ED19FE5BE8BC61"),
+	// Ultralight EV1
+	publicKey("90933BDCD6E99B4E255E3DA55389A827", "564E11718E017292FAF23226A96614B8"),
+}
+
+// SignatureSize is the size of the originality signature, r and s of 16 bytes each
+const SignatureSize = 32
+
+// VerifySignature checks the ECDSA signature of the UID. The UID is signed
+// as is, without hashing.
+func VerifySignature(pub *ecdsa.PublicKey, uid []byte, signature []byte) bool {
+	if len(signature) != SignatureSize {
+		return false
+	}
+	r := new(big.Int).SetBytes(signature[:16])
+	s := new(big.Int).SetBytes(signature[16:])
+	return ecdsa.Verify(pub, uid, r, s)
+}
+
+// ReadSignature reads the originality signature with READ_SIG
+func (t *Ultralight) ReadSignature() (signature []byte, err error) {
+	resp, err := t.r.transceiveRaw(&RawFrame{
+		Data:  []byte{commands.PICC_UL_READ_SIG, 0x00},
+		TxCRC: true,
+		RxCRC: true,
+	})
+	if isNAK(resp) {
+		err = errors.New(fmt.Sprintf("READ_SIG refused, NAK %X", resp.Data[0]))
+		return
+	}
+	if err != nil {
+		return
+	}
+	if len(resp.Data) != SignatureSize {
+		err = errors.New(fmt.Sprintf("Expected %d bytes, actual %d", SignatureSize, len(resp.Data)))
+		return
+	}
+	signature = resp.Data
+	return
+}
+
+// Genuine reads the signature and checks it against OriginalityKeys
+func (t *Ultralight) Genuine() (genuine bool, err error) {
+	signature, err := t.ReadSignature()
+	if err != nil {
+		return
+	}
+	for _, key := range OriginalityKeys {
+		if VerifySignature(key, t.uid, signature) {
+			genuine = true
+			return
+		}
+	}
+	return
+}
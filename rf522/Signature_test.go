@@ -0,0 +1,82 @@
+package rf522
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOriginalityKeysOnCurve(t *testing.T) {
+	assert.True(t, secp128r1.IsOnCurve(secp128r1.Gx, secp128r1.Gy))
+	for _, key := range OriginalityKeys {
+		assert.True(t, secp128r1.IsOnCurve(key.X, key.Y))
+	}
+}
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, uid []byte) []byte {
+	r, s, err := ecdsa.Sign(rand.Reader, key, uid)
+	if !assert.NoError(t, err) {
+		return nil
+	}
+	signature := make([]byte, SignatureSize)
+	rb, sb := r.Bytes(), s.Bytes()
+	copy(signature[16-len(rb):16], rb)
+	copy(signature[32-len(sb):], sb)
+	return signature
+}
+
+func TestVerifySignature(t *testing.T) {
+	key, err := ecdsa.GenerateKey(secp128r1, rand.Reader)
+	if !assert.NoError(t, err) {
+		return
+	}
+	uid := []byte{0x04, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66}
+	signature := sign(t, key, uid)
+	assert.True(t, VerifySignature(&key.PublicKey, uid, signature))
+	assert.False(t, VerifySignature(&key.PublicKey, []byte{0x04, 0x11, 0x22, 0x33, 0x44, 0x55, 0x67}, signature))
+	assert.False(t, VerifySignature(OriginalityKeys[0], uid, signature))
+	assert.False(t, VerifySignature(&key.PublicKey, uid, signature[:31]))
+	signature[0] ^= 0x01
+	assert.False(t, VerifySignature(&key.PublicKey, uid, signature))
+}
+
+func TestGenuine(t *testing.T) {
+	key, err := ecdsa.GenerateKey(secp128r1, rand.Reader)
+	if !assert.NoError(t, err) {
+		return
+	}
+	saved := OriginalityKeys
+	OriginalityKeys = []*ecdsa.PublicKey{saved[0], &key.PublicKey}
+	defer func() {
+		OriginalityKeys = saved
+	}()
+
+	uid := []byte{0x04, 1, 2, 3, 4, 5, 6}
+	card := newUltralightCard(uid)
+	card.signature = sign(t, key, uid)
+	r, _ := newFakeRFID(card)
+	err = r.WithUltralight(func(tag *Ultralight) (err error) {
+		genuine, err := tag.Genuine()
+		assert.True(t, genuine)
+		return
+	})
+	assert.NoError(t, err)
+
+	// signed for another tag
+	card.signature = sign(t, key, []byte{0x04, 9, 9, 9, 9, 9, 9})
+	err = r.WithUltralight(func(tag *Ultralight) (err error) {
+		genuine, err := tag.Genuine()
+		assert.False(t, genuine)
+		return
+	})
+	assert.NoError(t, err)
+
+	card.signature = nil
+	err = r.WithUltralight(func(tag *Ultralight) (err error) {
+		_, err = tag.Genuine()
+		return
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,130 @@
+package rf522
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+)
+
+// TraceEvent is a single register access
+type TraceEvent struct {
+	Time     time.Time
+	Write    bool
+	Register byte
+	Value    byte
+	Err      error
+}
+
+// String formats the event as a single line: time, direction, register,
+// value, the command name for CommandReg and the error, if any
+func (e TraceEvent) String() string {
+	dir := "R"
+	if e.Write {
+		dir = "W"
+	}
+	line := fmt.Sprintf("%s\t%s\t%s\t0x%02X", e.Time.Format("15:04:05.000000"), dir,
+		commands.RegisterName(e.Register), e.Value)
+	if e.Register == commands.CommandReg {
+		line += "\t" + commands.CommandName(e.Value)
+	}
+	if e.Err != nil {
+		line += "\terror: " + e.Err.Error()
+	}
+	return line
+}
+
+// Tracer receives every register access of the reader
+type Tracer func(e TraceEvent)
+
+// SetTracer installs the tracer, nil disables tracing
+func (r *RFID) SetTracer(t Tracer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.tracer = t
+}
+
+func (r *RFID) trace(write bool, address int, value byte, err error) {
+	if r.tracer != nil {
+		r.tracer(TraceEvent{
+			Time:     time.Now(),
+			Write:    write,
+			Register: byte(address),
+			Value:    value,
+			Err:      err,
+		})
+	}
+}
+
+// TraceWriter writes the trace events as text lines
+type TraceWriter struct {
+	w  io.Writer
+	mu sync.Mutex
+}
+
+func NewTraceWriter(w io.Writer) *TraceWriter {
+	return &TraceWriter{w: w}
+}
+
+// OpenTraceFile appends the trace to the file, the file is created if needed
+func OpenTraceFile(path string) (t *TraceWriter, err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return
+	}
+	t = NewTraceWriter(f)
+	return
+}
+
+// Trace is the Tracer writing to the underlying writer
+func (t *TraceWriter) Trace(e TraceEvent) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	fmt.Fprintln(t.w, e.String())
+}
+
+// Close closes the underlying writer if it can be closed
+func (t *TraceWriter) Close() (err error) {
+	if c, ok := t.w.(io.Closer); ok {
+		err = c.Close()
+	}
+	return
+}
+
+// RegisterDump is a snapshot of all the registers of the chip
+type RegisterDump [64]byte
+
+// String lists the registers, one per line, skipping the reserved ones
+func (d *RegisterDump) String() string {
+	var b bytes.Buffer
+	for i, v := range d {
+		name := commands.RegisterName(byte(i))
+		if strings.HasPrefix(name, "Reserved") {
+			continue
+		}
+		fmt.Fprintf(&b, "0x%02X %-18s 0x%02X\n", i, name, v)
+	}
+	return b.String()
+}
+
+// DumpRegisters reads all the registers. FIFODataReg is not read as that would
+// consume the FIFO, it is reported as 0.
+func (r *RFID) DumpRegisters() (dump RegisterDump, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range dump {
+		if i == commands.FIFODataReg {
+			continue
+		}
+		dump[i], err = r.devRead(i)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
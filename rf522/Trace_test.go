@@ -0,0 +1,59 @@
+package rf522
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintBytes(t *testing.T) {
+	assert.Equal(t, "[]", printBytes(nil))
+	assert.Equal(t, "[0a]", printBytes([]byte{0x0A}))
+	assert.Equal(t, "[01, ff]", printBytes([]byte{0x01, 0xFF}))
+}
+
+func TestTrace(t *testing.T) {
+	chip := new(registerFile)
+	r := &RFID{transport: chip}
+	var events []TraceEvent
+	r.SetTracer(func(e TraceEvent) {
+		events = append(events, e)
+	})
+	assert.NoError(t, r.devWrite(commands.CommandReg, commands.PCD_TRANSCEIVE))
+	_, err := r.devRead(commands.VersionReg)
+	assert.NoError(t, err)
+	if assert.Len(t, events, 2) {
+		assert.True(t, events[0].Write)
+		assert.Equal(t, byte(commands.CommandReg), events[0].Register)
+		assert.True(t, strings.HasSuffix(events[0].String(), "W\tCommandReg\t0x0C\tTransceive"), events[0].String())
+		assert.False(t, events[1].Write)
+		assert.True(t, strings.HasSuffix(events[1].String(), "R\tVersionReg\t0x00"), events[1].String())
+	}
+
+	var out bytes.Buffer
+	tw := NewTraceWriter(&out)
+	r.SetTracer(tw.Trace)
+	assert.NoError(t, r.devWrite(commands.BitFramingReg, 0x87))
+	assert.Contains(t, out.String(), "BitFramingReg\t0x87\n")
+	assert.NoError(t, tw.Close())
+
+	r.SetTracer(nil)
+	assert.NoError(t, r.devWrite(commands.BitFramingReg, 0x00))
+	assert.Len(t, events, 2)
+}
+
+func TestDumpRegisters(t *testing.T) {
+	r, chip := newFakeRFID(nil)
+	chip.regs[commands.VersionReg] = VersionMFRC522v2
+	chip.fifo = []byte{1, 2, 3}
+	dump, err := r.DumpRegisters()
+	assert.NoError(t, err)
+	assert.Equal(t, byte(VersionMFRC522v2), dump[commands.VersionReg])
+	assert.Equal(t, byte(3), dump[commands.FIFOLevelReg])
+	assert.Len(t, chip.fifo, 3, "FIFO must not be consumed")
+	assert.Contains(t, dump.String(), "0x37 VersionReg         0x92\n")
+	assert.NotContains(t, dump.String(), "Reserved")
+}
@@ -0,0 +1,231 @@
+package rf522
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+)
+
+// ErrorReg bits
+const (
+	ErrProtocol    = 0x01
+	ErrParity      = 0x02
+	ErrCRC         = 0x04
+	ErrCollision   = 0x08
+	ErrBufferOvfl  = 0x10
+	ErrTemperature = 0x40
+	ErrWrite       = 0x80
+)
+
+// FIFOSize is the size of the chip FIFO buffer, the longest frame TransceiveRaw can send or receive
+const FIFOSize = 64
+
+// RawFrame is a frame sent to the card by TransceiveRaw
+type RawFrame struct {
+	Data       []byte
+	TxLastBits byte          // number of bits of the last byte to send, 0 sends all 8
+	RxAlign    byte          // bit position of the first received bit in the first byte
+	TxCRC      bool          // the chip appends CRC_A to the frame
+	RxCRC      bool          // the chip checks and strips CRC_A of the response
+	NoParity   bool          // send and receive without parity bits
+	Timeout    time.Duration // 0 keeps the timer of the RF configuration
+}
+
+// RawResponse is what the card answered to a RawFrame
+type RawResponse struct {
+	Data         []byte
+	Bits         int  // number of valid bits in Data
+	Collision    bool // a bit collision was detected
+	CollisionPos int  // position of the first colliding bit, starting from 1, 0 if unknown
+	Errors       byte // content of ErrorReg
+}
+
+func (r *RFID) timerReload(timeout time.Duration) (reload uint16) {
+	ticks := math.Floor(timeout.Seconds()*13560000/float64(r.rfConfig.divider()) + 0.5)
+	switch {
+	case ticks < 1:
+		reload = 0
+	case ticks > 0xFFFF:
+		reload = 0xFFFF
+	default:
+		reload = uint16(ticks) - 1
+	}
+	return
+}
+
+func (r *RFID) writeTimerReload(reload uint16) (err error) {
+	err = r.devWrite(commands.TReloadRegL, byte(reload))
+	if err != nil {
+		return
+	}
+	err = r.devWrite(commands.TReloadRegH, byte(reload>>8))
+	return
+}
+
+func (r *RFID) updateRegister(address int, mask byte, value byte) (err error) {
+	current, err := r.devRead(address)
+	if err != nil {
+		return
+	}
+	err = r.devWrite(address, current&^mask|value&mask)
+	return
+}
+
+// TransceiveRaw sends the frame to the card and returns the response.
+// Unlike the other operations it gives full control over the bit framing,
+// CRC and parity, so it can be used for anticollision with short frames or
+// for the proprietary commands of the cards this package doesn't know.
+// ErrTimeout is returned if the card doesn't answer.
+func (r *RFID) TransceiveRaw(frame *RawFrame) (resp *RawResponse, err error) {
+	if len(frame.Data) == 0 || len(frame.Data) > FIFOSize {
+		err = errors.New(fmt.Sprintf("frame length %d is out of range", len(frame.Data)))
+		return
+	}
+	if frame.TxLastBits > 7 || frame.RxAlign > 7 {
+		err = errors.New(fmt.Sprintf("bit framing out of range: %d/%d", frame.TxLastBits, frame.RxAlign))
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	resp, err = r.transceiveRaw(frame)
+	return
+}
+
+func (r *RFID) transceiveRaw(frame *RawFrame) (resp *RawResponse, err error) {
+	err = r.updateRegister(commands.TxModeReg, 0x80, boolBit(frame.TxCRC, 0x80))
+	if err != nil {
+		return
+	}
+	err = r.updateRegister(commands.RxModeReg, 0x80, boolBit(frame.RxCRC, 0x80))
+	if err != nil {
+		return
+	}
+	err = r.updateRegister(commands.MfRxReg, 0x10, boolBit(frame.NoParity, 0x10))
+	if err != nil {
+		return
+	}
+	defer func() {
+		r.updateRegister(commands.TxModeReg, 0x80, 0)
+		r.updateRegister(commands.RxModeReg, 0x80, 0)
+		r.updateRegister(commands.MfRxReg, 0x10, 0)
+	}()
+	deadline := 2 * r.rfConfig.Timeout()
+	if frame.Timeout > 0 {
+		err = r.writeTimerReload(r.timerReload(frame.Timeout))
+		if err != nil {
+			return
+		}
+		defer r.writeTimerReload(r.rfConfig.Timer.Reload)
+		deadline = 2 * frame.Timeout
+	}
+	deadline = deadline + 10*time.Millisecond
+
+	err = r.devWrite(commands.CommandReg, commands.PCD_IDLE)
+	if err != nil {
+		return
+	}
+	// clear all the interrupt request bits and flush the FIFO
+	err = r.devWrite(commands.CommIrqReg, 0x7F)
+	if err != nil {
+		return
+	}
+	err = r.devWrite(commands.FIFOLevelReg, 0x80)
+	if err != nil {
+		return
+	}
+	for _, v := range frame.Data {
+		err = r.devWrite(commands.FIFODataReg, v)
+		if err != nil {
+			return
+		}
+	}
+	err = r.devWrite(commands.CommandReg, commands.PCD_TRANSCEIVE)
+	if err != nil {
+		return
+	}
+	err = r.devWrite(commands.BitFramingReg, 0x80|frame.RxAlign<<4|frame.TxLastBits)
+	if err != nil {
+		return
+	}
+
+	var irq byte
+	for start := time.Now(); ; {
+		irq, err = r.devRead(commands.CommIrqReg)
+		if err != nil {
+			return
+		}
+		// RxIRq, IdleIRq or TimerIRq
+		if irq&0x31 != 0 {
+			break
+		}
+		if time.Since(start) > deadline {
+			err = errors.New("transceive didn't complete in time")
+			return
+		}
+	}
+	err = r.devWrite(commands.BitFramingReg, 0x00)
+	if err != nil {
+		return
+	}
+	if irq&0x30 == 0 {
+		err = ErrTimeout
+		return
+	}
+
+	resp = new(RawResponse)
+	resp.Errors, err = r.devRead(commands.ErrorReg)
+	if err != nil {
+		return
+	}
+	if resp.Errors&ErrCollision != 0 {
+		resp.Collision = true
+		coll, err1 := r.devRead(commands.CollReg)
+		if err1 != nil {
+			err = err1
+			return
+		}
+		// CollPosNotValid
+		if coll&0x20 == 0 {
+			resp.CollisionPos = int(coll & 0x1F)
+			if resp.CollisionPos == 0 {
+				resp.CollisionPos = 32
+			}
+		}
+	}
+
+	n, err := r.devRead(commands.FIFOLevelReg)
+	if err != nil {
+		return
+	}
+	control, err := r.devRead(commands.ControlReg)
+	if err != nil {
+		return
+	}
+	n = n & 0x7F
+	resp.Bits = int(n) * 8
+	if lastBits := control & 0x07; lastBits != 0 && n > 0 {
+		resp.Bits = (int(n)-1)*8 + int(lastBits)
+	}
+	resp.Data = make([]byte, n)
+	for i := range resp.Data {
+		resp.Data[i], err = r.devRead(commands.FIFODataReg)
+		if err != nil {
+			return
+		}
+	}
+
+	fatal := byte(ErrProtocol | ErrBufferOvfl)
+	if frame.RxCRC {
+		fatal |= ErrCRC
+	}
+	if !frame.NoParity {
+		fatal |= ErrParity
+	}
+	if resp.Errors&fatal != 0 {
+		err = errors.New(fmt.Sprintf("transceive error, ErrorReg %02x", resp.Errors))
+	}
+	return
+}
@@ -0,0 +1,70 @@
+package rf522
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransceiveRawShortFrame(t *testing.T) {
+	card := newClassicCard([]byte{1, 2, 3, 4})
+	r, chip := newFakeRFID(card)
+
+	resp, err := r.TransceiveRaw(&RawFrame{Data: []byte{commands.PICC_REQALL}, TxLastBits: 7})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x04, 0x00}, resp.Data)
+	assert.Equal(t, 16, resp.Bits)
+	assert.False(t, resp.Collision)
+	assert.Equal(t, byte(0x00), chip.regs[commands.BitFramingReg])
+}
+
+func TestTransceiveRawCRC(t *testing.T) {
+	card := newClassicCard([]byte{1, 2, 3, 4})
+	r, chip := newFakeRFID(card)
+
+	_, err := r.TransceiveRaw(&RawFrame{Data: []byte{commands.PICC_REQALL}, TxLastBits: 7})
+	assert.NoError(t, err)
+	resp, err := r.TransceiveRaw(&RawFrame{Data: []byte{commands.PICC_ANTICOLL, 0x20}})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{1, 2, 3, 4, 4}, resp.Data)
+
+	resp, err = r.TransceiveRaw(&RawFrame{
+		Data:  append([]byte{commands.PICC_SElECTTAG, 0x70}, resp.Data...),
+		TxCRC: true,
+		RxCRC: true,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x08}, resp.Data)
+	assert.Equal(t, 8, resp.Bits)
+	assert.Equal(t, withCRC(commands.PICC_SElECTTAG, 0x70, 1, 2, 3, 4, 4), chip.sent[2])
+	// CRC and parity are switched back for the other operations
+	assert.Equal(t, byte(0), chip.regs[commands.TxModeReg]&0x80)
+	assert.Equal(t, byte(0), chip.regs[commands.RxModeReg]&0x80)
+}
+
+func TestTransceiveRawTimeoutAndCollision(t *testing.T) {
+	card := newClassicCard([]byte{1, 2, 3, 4})
+	r, chip := newFakeRFID(card)
+
+	_, err := r.TransceiveRaw(&RawFrame{Data: []byte{commands.PICC_HALT, 0}, TxCRC: true, Timeout: 5 * time.Millisecond})
+	assert.Equal(t, ErrTimeout, err)
+	// the timer is restored after the custom timeout
+	assert.Equal(t, byte(30), chip.regs[commands.TReloadRegL])
+
+	chip.collPos = 0x0B
+	resp, err := r.TransceiveRaw(&RawFrame{Data: []byte{commands.PICC_REQALL}, TxLastBits: 7})
+	assert.NoError(t, err)
+	assert.True(t, resp.Collision)
+	assert.Equal(t, 11, resp.CollisionPos)
+
+	_, err = r.TransceiveRaw(&RawFrame{Data: make([]byte, FIFOSize+1)})
+	assert.Error(t, err)
+}
+
+func TestTimerReload(t *testing.T) {
+	r := &RFID{rfConfig: DefaultRFConfig()}
+	assert.Equal(t, uint16(30), r.timerReload(r.rfConfig.Timeout()))
+	assert.Equal(t, uint16(0xFFFF), r.timerReload(time.Hour))
+}
@@ -0,0 +1,15 @@
+package rf522
+
+// Transport carries register reads and writes between the host and the
+// MFRC522. The chip supports SPI, I2C and UART host interfaces.
+type Transport interface {
+	ReadRegister(address byte) (byte, error)
+	WriteRegister(address byte, value byte) error
+	Close() error
+}
+
+// resyncer is implemented by the transports that have to restore their
+// settings after the chip soft reset
+type resyncer interface {
+	resync() error
+}
@@ -0,0 +1,41 @@
+package rf522
+
+import (
+	"fmt"
+
+	"golang.org/x/exp/io/i2c"
+)
+
+// DefaultI2CAddress is the address of the chip with both address pins low
+const DefaultI2CAddress = 0x28
+
+// I2CTransport talks to the chip over /dev/i2c-N. The register address is
+// sent as the first byte of every transaction.
+type I2CTransport struct {
+	dev *i2c.Device
+}
+
+func OpenI2C(bus, address int) (t *I2CTransport, err error) {
+	dev, err := i2c.Open(&i2c.Devfs{Dev: fmt.Sprintf("/dev/i2c-%d", bus)}, address)
+	if err != nil {
+		return
+	}
+	t = &I2CTransport{dev: dev}
+	return
+}
+
+func (t *I2CTransport) WriteRegister(address byte, value byte) (err error) {
+	err = t.dev.WriteReg(address&0x3F, []byte{value})
+	return
+}
+
+func (t *I2CTransport) ReadRegister(address byte) (value byte, err error) {
+	buf := make([]byte, 1)
+	err = t.dev.ReadReg(address&0x3F, buf)
+	value = buf[0]
+	return
+}
+
+func (t *I2CTransport) Close() error {
+	return t.dev.Close()
+}
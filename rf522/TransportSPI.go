@@ -0,0 +1,67 @@
+package rf522
+
+import (
+	"fmt"
+
+	"github.com/ecc1/spi"
+)
+
+// SPIConn is the part of *spi.Device the transport uses
+type SPIConn interface {
+	Transfer(buf []byte) error
+	Close() error
+}
+
+// SPITransport talks to the chip over /dev/spidevB.D
+type SPITransport struct {
+	dev SPIConn
+}
+
+// NewSPITransport uses an already opened bus, e.g. a recorded session
+func NewSPITransport(conn SPIConn) *SPITransport {
+	return &SPITransport{dev: conn}
+}
+
+func OpenSPI(busId, deviceId, maxSpeed int) (t *SPITransport, err error) {
+	spiDev, err := spi.Open(fmt.Sprintf("/dev/spidev%d.%d", busId, deviceId), maxSpeed, 0)
+
+	if err != nil {
+		return
+	}
+
+	err = spiDev.SetLSBFirst(false)
+	if err != nil {
+		spiDev.Close()
+		return
+	}
+
+	err = spiDev.SetBitsPerWord(8)
+
+	if err != nil {
+		spiDev.Close()
+		return
+	}
+
+	t = NewSPITransport(spiDev)
+	return
+}
+
+// WriteRegister sends the address shifted left by one bit, followed by the value
+func (t *SPITransport) WriteRegister(address byte, value byte) (err error) {
+	data := [2]byte{(address << 1) & 0x7E, value}
+	err = t.dev.Transfer(data[:])
+	return
+}
+
+// ReadRegister sends the shifted address with bit 7 set and receives the value
+// in the second byte of the transfer
+func (t *SPITransport) ReadRegister(address byte) (value byte, err error) {
+	data := [2]byte{((address << 1) & 0x7E) | 0x80, 0}
+	err = t.dev.Transfer(data[:])
+	value = data[1]
+	return
+}
+
+func (t *SPITransport) Close() error {
+	return t.dev.Close()
+}
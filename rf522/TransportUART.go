@@ -0,0 +1,113 @@
+package rf522
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+)
+
+// DefaultBaudRate is the UART speed of the chip after reset
+const DefaultBaudRate = 9600
+
+// serialSpeeds maps the baud rate to the SerialSpeedReg value
+var serialSpeeds = map[int]byte{
+	9600:   0xEB,
+	19200:  0xCB,
+	38400:  0xAB,
+	57600:  0x9A,
+	115200: 0x7A,
+	230400: 0x5A,
+	460800: 0x3A,
+	921600: 0x1C,
+}
+
+type serialPort interface {
+	io.ReadWriteCloser
+	setBaud(baud int) error
+}
+
+// UARTTransport talks to the chip over a serial port. Reads send the
+// address with bit 7 set and receive the value, writes send the address
+// and the value and receive the address back.
+type UARTTransport struct {
+	port serialPort
+	baud int
+}
+
+func OpenUART(name string, baud int) (t *UARTTransport, err error) {
+	if _, ok := serialSpeeds[baud]; !ok {
+		err = errors.New(fmt.Sprintf("unsupported baud rate %d", baud))
+		return
+	}
+	port, err := openSerial(name, DefaultBaudRate)
+	if err != nil {
+		return
+	}
+	uart := &UARTTransport{port: port, baud: baud}
+	err = uart.resync()
+	if err != nil {
+		port.Close()
+		return
+	}
+	t = uart
+	return
+}
+
+// resync negotiates the baud rate, starting from the chip default
+func (t *UARTTransport) resync() (err error) {
+	err = t.port.setBaud(DefaultBaudRate)
+	if err != nil || t.baud == DefaultBaudRate {
+		return
+	}
+	err = t.WriteRegister(commands.SerialSpeedReg, serialSpeeds[t.baud])
+	if err != nil {
+		return
+	}
+	err = t.port.setBaud(t.baud)
+	if err != nil {
+		return
+	}
+	// make sure the chip follows
+	_, err = t.ReadRegister(commands.VersionReg)
+	return
+}
+
+func (t *UARTTransport) readByte() (value byte, err error) {
+	buf := make([]byte, 1)
+	_, err = io.ReadFull(t.port, buf)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		err = errors.New("UART read timeout")
+	}
+	value = buf[0]
+	return
+}
+
+func (t *UARTTransport) WriteRegister(address byte, value byte) (err error) {
+	_, err = t.port.Write([]byte{address & 0x3F, value})
+	if err != nil {
+		return
+	}
+	echo, err := t.readByte()
+	if err != nil {
+		return
+	}
+	if echo != address&0x3F {
+		err = errors.New(fmt.Sprintf("UART write echo mismatch, expected %02x actual %02x", address&0x3F, echo))
+	}
+	return
+}
+
+func (t *UARTTransport) ReadRegister(address byte) (value byte, err error) {
+	_, err = t.port.Write([]byte{0x80 | address&0x3F})
+	if err != nil {
+		return
+	}
+	value, err = t.readByte()
+	return
+}
+
+func (t *UARTTransport) Close() error {
+	return t.port.Close()
+}
@@ -0,0 +1,65 @@
+package rf522
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeUART emulates the chip side of the UART protocol
+type fakeUART struct {
+	regs  [64]byte
+	baud  int
+	bauds []int
+	out   bytes.Buffer
+	addr  int
+}
+
+func (f *fakeUART) Write(buf []byte) (int, error) {
+	for _, b := range buf {
+		switch {
+		case f.addr >= 0:
+			f.regs[f.addr] = b
+			f.addr = -1
+		case b&0x80 != 0:
+			f.out.WriteByte(f.regs[b&0x3F])
+		default:
+			f.addr = int(b)
+			f.out.WriteByte(b)
+		}
+	}
+	return len(buf), nil
+}
+
+func (f *fakeUART) Read(buf []byte) (int, error) {
+	return f.out.Read(buf)
+}
+
+func (f *fakeUART) Close() error {
+	return nil
+}
+
+func (f *fakeUART) setBaud(baud int) error {
+	f.bauds = append(f.bauds, baud)
+	return nil
+}
+
+func TestUARTTransport(t *testing.T) {
+	port := &fakeUART{addr: -1}
+	port.regs[commands.VersionReg] = 0x92
+	uart := &UARTTransport{port: port, baud: 115200}
+
+	assert.NoError(t, uart.resync())
+	assert.Equal(t, []int{9600, 115200}, port.bauds)
+	assert.Equal(t, byte(0x7A), port.regs[commands.SerialSpeedReg])
+
+	assert.NoError(t, uart.WriteRegister(commands.TModeReg, 0x8D))
+	v, err := uart.ReadRegister(commands.TModeReg)
+	assert.NoError(t, err)
+	assert.Equal(t, byte(0x8D), v)
+
+	_, err = uart.readByte()
+	assert.Error(t, err)
+}
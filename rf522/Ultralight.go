@@ -0,0 +1,259 @@
+package rf522
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+)
+
+// random provides RndA, tests replace it to replay a fixed exchange
+var random io.Reader = rand.Reader
+
+// MIFARE Ultralight C configuration pages
+const (
+	UltralightCAuth0Page = 0x2A // first page protected by the key, 0x30 disables the protection
+	UltralightCAuth1Page = 0x2B // bit 0 set protects writes only, cleared protects reads too
+	UltralightCKeyPage   = 0x2C // first of the four write-only key pages
+)
+
+// DefaultUltralightCKey is the factory key. The key pages store it as
+// "BREAKMEIFYOUCAN!" because every half of the key is written in reverse.
+var DefaultUltralightCKey = []byte("IEMKAERB!NACUOYF")
+
+var cascadeLevels = []byte{commands.PICC_ANTICOLL, commands.PICC_ANTICOLL_CL2, commands.PICC_ANTICOLL_CL3}
+
+// selectCascade selects a card with a 4, 7 or 10 byte UID, going through
+// as many cascade levels as the card asks for
+func (r *RFID) selectCascade() (uid []byte, sak byte, err error) {
+	err = r.initChip()
+	if err != nil {
+		return
+	}
+	_, err = r.request()
+	if err != nil {
+		return
+	}
+	for _, level := range cascadeLevels {
+		resp, err1 := r.transceiveRaw(&RawFrame{Data: []byte{level, 0x20}})
+		if err1 != nil {
+			err = err1
+			return
+		}
+		part := resp.Data
+		if len(part) != 5 || part[0]^part[1]^part[2]^part[3] != part[4] {
+			err = errors.New(fmt.Sprintf("bad anticollision response %s", printBytes(part)))
+			return
+		}
+		resp, err = r.transceiveRaw(&RawFrame{
+			Data:  append([]byte{level, 0x70}, part...),
+			TxCRC: true,
+			RxCRC: true,
+		})
+		if err != nil {
+			return
+		}
+		if len(resp.Data) != 1 {
+			err = errors.New(fmt.Sprintf("bad select response %s", printBytes(resp.Data)))
+			return
+		}
+		sak = resp.Data[0]
+		// cascade bit, the UID continues at the next level
+		if sak&0x04 == 0 {
+			uid = append(uid, part[0:4]...)
+			return
+		}
+		// the first byte is the cascade tag 0x88
+		uid = append(uid, part[1:4]...)
+	}
+	err = errors.New("UID longer than 3 cascade levels")
+	return
+}
+
+// Ultralight is a selected MIFARE Ultralight or Ultralight C tag. It is only
+// valid inside WithUltralight.
+type Ultralight struct {
+	r   *RFID
+	uid []byte
+}
+
+// WithUltralight waits for the tag, selects it and runs f while holding the
+// reader lock
+func (r *RFID) WithUltralight(f func(tag *Ultralight) error) (err error) {
+	err = r.Wait()
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	uid, _, err := r.selectCascade()
+	if err != nil {
+		return
+	}
+	err = f(&Ultralight{r: r, uid: uid})
+	return
+}
+
+// UID returns the UID of the tag, 4, 7 or 10 bytes long
+func (t *Ultralight) UID() []byte {
+	return t.uid
+}
+
+func isNAK(resp *RawResponse) bool {
+	return resp != nil && resp.Bits == 4 && len(resp.Data) == 1 && resp.Data[0]&0x0F != 0x0A
+}
+
+// ReadPages reads 4 pages (16 bytes) starting with the given one. The read
+// wraps around to page 0 past the last page.
+func (t *Ultralight) ReadPages(page byte) (data []byte, err error) {
+	resp, err := t.r.transceiveRaw(&RawFrame{
+		Data:  []byte{commands.PICC_READ, page},
+		TxCRC: true,
+		RxCRC: true,
+	})
+	if isNAK(resp) {
+		err = errors.New(fmt.Sprintf("page %d: read refused, NAK %X", page, resp.Data[0]))
+		return
+	}
+	if err != nil {
+		return
+	}
+	if len(resp.Data) != 16 {
+		err = errors.New(fmt.Sprintf("Expected 16 bytes, actual %d", len(resp.Data)))
+		return
+	}
+	data = resp.Data
+	return
+}
+
+// WritePage writes a single 4 byte page
+func (t *Ultralight) WritePage(page byte, data [4]byte) (err error) {
+	resp, err := t.r.transceiveRaw(&RawFrame{
+		Data:  append([]byte{commands.PICC_UL_WRITE, page}, data[:]...),
+		TxCRC: true,
+	})
+	if err != nil {
+		return
+	}
+	if resp.Bits != 4 || resp.Data[0]&0x0F != 0x0A {
+		err = errors.New(fmt.Sprintf("page %d: write refused %s", page, printBytes(resp.Data)))
+	}
+	return
+}
+
+func tripleDES(key []byte) (block cipher.Block, err error) {
+	if len(key) != 16 {
+		err = errors.New(fmt.Sprintf("3DES key must be 16 bytes, got %d", len(key)))
+		return
+	}
+	// two key 3DES: K1, K2, K1
+	k := make([]byte, 24)
+	copy(k, key)
+	copy(k[16:], key[:8])
+	block, err = des.NewTripleDESCipher(k)
+	return
+}
+
+func rotateLeft(data []byte) []byte {
+	return append(append([]byte{}, data[1:]...), data[0])
+}
+
+// Authenticate runs the 3DES mutual authentication of Ultralight C: the tag
+// proves it knows the key by decrypting RndA, the reader by decrypting RndB.
+// Both random numbers are rotated left by one byte before they are sent back.
+// The CBC chaining carries over from one message to the next.
+func (t *Ultralight) Authenticate(key []byte) (err error) {
+	block, err := tripleDES(key)
+	if err != nil {
+		return
+	}
+	resp, err := t.r.transceiveRaw(&RawFrame{
+		Data:  []byte{commands.PICC_UL_AUTH, 0x00},
+		TxCRC: true,
+		RxCRC: true,
+	})
+	if err != nil {
+		return
+	}
+	if len(resp.Data) != 9 || resp.Data[0] != commands.PICC_UL_AUTH_CONT {
+		err = errors.New(fmt.Sprintf("unexpected authentication response %s", printBytes(resp.Data)))
+		return
+	}
+	encRndB := resp.Data[1:9]
+	rndB := make([]byte, 8)
+	cipher.NewCBCDecrypter(block, make([]byte, 8)).CryptBlocks(rndB, encRndB)
+
+	rndA := make([]byte, 8)
+	if _, err = io.ReadFull(random, rndA); err != nil {
+		return
+	}
+	msg := append(append([]byte{}, rndA...), rotateLeft(rndB)...)
+	encMsg := make([]byte, 16)
+	cipher.NewCBCEncrypter(block, encRndB).CryptBlocks(encMsg, msg)
+
+	resp, err = t.r.transceiveRaw(&RawFrame{
+		Data:  append([]byte{commands.PICC_UL_AUTH_CONT}, encMsg...),
+		TxCRC: true,
+		RxCRC: true,
+	})
+	if isNAK(resp) || err == ErrTimeout {
+		err = errors.New("authentication failed, wrong key")
+		return
+	}
+	if err != nil {
+		return
+	}
+	if len(resp.Data) != 9 || resp.Data[0] != 0x00 {
+		err = errors.New(fmt.Sprintf("unexpected authentication response %s", printBytes(resp.Data)))
+		return
+	}
+	rndA2 := make([]byte, 8)
+	cipher.NewCBCDecrypter(block, encMsg[8:]).CryptBlocks(rndA2, resp.Data[1:9])
+	if !bytes.Equal(rndA2, rotateLeft(rndA)) {
+		err = errors.New("tag failed the authentication")
+	}
+	return
+}
+
+// keyPages returns the content of the key pages: every half of the key is
+// stored in reverse byte order
+func keyPages(key []byte) (pages [4][4]byte) {
+	for i := 0; i < 16; i++ {
+		half := i / 8 * 8
+		pages[i/4][i%4] = key[half+7-i%8]
+	}
+	return
+}
+
+// WriteKey changes the 3DES key. The key pages can't be read back, a wrong
+// key can be fixed only if the key pages are not protected.
+func (t *Ultralight) WriteKey(key []byte) (err error) {
+	if len(key) != 16 {
+		err = errors.New(fmt.Sprintf("3DES key must be 16 bytes, got %d", len(key)))
+		return
+	}
+	for i, p := range keyPages(key) {
+		err = t.WritePage(UltralightCKeyPage+byte(i), p)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// SetProtection protects the pages starting with auth0 with the key. With
+// writeOnly the pages can still be read without authentication. An auth0 of
+// 0x30 or above disables the protection.
+func (t *Ultralight) SetProtection(auth0 byte, writeOnly bool) (err error) {
+	err = t.WritePage(UltralightCAuth1Page, [4]byte{boolBit(writeOnly, 0x01)})
+	if err != nil {
+		return
+	}
+	err = t.WritePage(UltralightCAuth0Page, [4]byte{auth0})
+	return
+}
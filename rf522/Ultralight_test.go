@@ -0,0 +1,277 @@
+package rf522
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+// ultralightCard is a MIFARE Ultralight C with 48 pages
+type ultralightCard struct {
+	uid           []byte
+	pages         [48][4]byte
+	level         int
+	authenticated bool
+	rndB          []byte
+	lastIV        []byte
+	signature     []byte
+}
+
+func newUltralightCard(uid []byte) (c *ultralightCard) {
+	c = &ultralightCard{uid: uid}
+	copy(c.pages[UltralightCKeyPage][:], "BREA")
+	copy(c.pages[UltralightCKeyPage+1][:], "KMEI")
+	copy(c.pages[UltralightCKeyPage+2][:], "FYOU")
+	copy(c.pages[UltralightCKeyPage+3][:], "CAN!")
+	c.pages[UltralightCAuth0Page][0] = 0x30
+	return
+}
+
+func (c *ultralightCard) key() []byte {
+	key := make([]byte, 16)
+	for i := 0; i < 16; i++ {
+		half := i / 8 * 8
+		key[half+7-i%8] = c.pages[UltralightCKeyPage+i/4][i%4]
+	}
+	return key
+}
+
+func (c *ultralightCard) protected(page byte, write bool) bool {
+	auth0 := c.pages[UltralightCAuth0Page][0]
+	readToo := c.pages[UltralightCAuth1Page][0]&0x01 == 0
+	return !c.authenticated && page >= auth0 && (write || readToo)
+}
+
+func (c *ultralightCard) transceive(frame []byte, lastBits byte) (resp []byte, bits byte) {
+	nak := []byte{0x00}
+	switch {
+	case lastBits == 7 && (frame[0] == commands.PICC_REQIDL || frame[0] == commands.PICC_REQALL):
+		c.level = 0
+		c.authenticated = false
+		return []byte{0x44, 0x00}, 0
+	case len(frame) == 2 && frame[0] == commands.PICC_ANTICOLL && frame[1] == 0x20:
+		part := []byte{0x88, c.uid[0], c.uid[1], c.uid[2]}
+		return append(part, part[0]^part[1]^part[2]^part[3]), 0
+	case len(frame) == 9 && frame[0] == commands.PICC_ANTICOLL && frame[1] == 0x70:
+		c.level = 1
+		return withCRC(0x04), 0
+	case len(frame) == 2 && frame[0] == commands.PICC_ANTICOLL_CL2 && frame[1] == 0x20 && c.level == 1:
+		part := append([]byte{}, c.uid[3:7]...)
+		return append(part, part[0]^part[1]^part[2]^part[3]), 0
+	case len(frame) == 9 && frame[0] == commands.PICC_ANTICOLL_CL2 && frame[1] == 0x70 && c.level == 1:
+		if !bytes.Equal(frame[2:6], c.uid[3:7]) {
+			return
+		}
+		c.level = 2
+		return withCRC(0x00), 0
+	}
+	if c.level != 2 {
+		return
+	}
+	block, _ := tripleDES(c.key())
+	switch {
+	case len(frame) == 4 && frame[0] == commands.PICC_READ:
+		page := frame[1]
+		if int(page) >= len(c.pages) || c.protected(page, false) {
+			return nak, 4
+		}
+		var data []byte
+		for i := 0; i < 4; i++ {
+			p := (int(page) + i) % len(c.pages)
+			if p >= UltralightCKeyPage {
+				data = append(data, 0, 0, 0, 0)
+			} else {
+				data = append(data, c.pages[p][:]...)
+			}
+		}
+		return withCRC(data...), 0
+	case len(frame) == 8 && frame[0] == commands.PICC_UL_WRITE:
+		page := frame[1]
+		if page < 2 || int(page) >= len(c.pages) || c.protected(page, true) {
+			return nak, 4
+		}
+		copy(c.pages[page][:], frame[2:6])
+		return []byte{0x0A}, 4
+	case len(frame) == 4 && frame[0] == commands.PICC_UL_READ_SIG && frame[1] == 0x00:
+		if c.signature == nil {
+			return nak, 4
+		}
+		return withCRC(c.signature...), 0
+	case len(frame) == 4 && frame[0] == commands.PICC_UL_AUTH && frame[1] == 0x00:
+		c.authenticated = false
+		c.rndB = []byte{1, 2, 3, 4, 5, 6, 7, 8}
+		enc := make([]byte, 8)
+		cipher.NewCBCEncrypter(block, make([]byte, 8)).CryptBlocks(enc, c.rndB)
+		c.lastIV = enc
+		return withCRC(append([]byte{commands.PICC_UL_AUTH_CONT}, enc...)...), 0
+	case len(frame) == 19 && frame[0] == commands.PICC_UL_AUTH_CONT && c.rndB != nil:
+		msg := make([]byte, 16)
+		cipher.NewCBCDecrypter(block, c.lastIV).CryptBlocks(msg, frame[1:17])
+		rndB := c.rndB
+		c.rndB = nil
+		if !bytes.Equal(msg[8:], rotateLeft(rndB)) {
+			return nak, 4
+		}
+		enc := make([]byte, 8)
+		cipher.NewCBCEncrypter(block, frame[9:17]).CryptBlocks(enc, rotateLeft(msg[:8]))
+		c.authenticated = true
+		return withCRC(append([]byte{0x00}, enc...)...), 0
+	}
+	return
+}
+
+func (c *ultralightCard) auth(mode byte, block byte, key []byte, uid []byte) bool {
+	return false
+}
+
+func TestDESKnownAnswer(t *testing.T) {
+	// the classic DES example, a two key 3DES with K1 == K2 degrades to DES
+	key, _ := hex.DecodeString("133457799BBCDFF1133457799BBCDFF1")
+	plain, _ := hex.DecodeString("0123456789ABCDEF")
+	block, err := tripleDES(key)
+	assert.NoError(t, err)
+	out := make([]byte, 8)
+	block.Encrypt(out, plain)
+	assert.Equal(t, "85e813540f0ab405", hex.EncodeToString(out))
+}
+
+func TestKeyPagesDatasheet(t *testing.T) {
+	// MF0ICU2 key programming example: Key1 0102..08, Key2 090A..10
+	key, _ := hex.DecodeString("0102030405060708090A0B0C0D0E0F10")
+	assert.Equal(t, [4][4]byte{
+		{0x08, 0x07, 0x06, 0x05}, // page 2Ch
+		{0x04, 0x03, 0x02, 0x01}, // page 2Dh
+		{0x10, 0x0F, 0x0E, 0x0D}, // page 2Eh
+		{0x0C, 0x0B, 0x0A, 0x09}, // page 2Fh
+	}, keyPages(key))
+}
+
+// fixedAuthCard answers the authentication with fixed bytes. The exchange
+// was computed with OpenSSL des-ede-cbc, not with the helpers under test,
+// for the default key, RndA A0..A7 and RndB B0..B7.
+type fixedAuthCard struct {
+	*ultralightCard
+}
+
+const (
+	fixedRndA      = "A0A1A2A3A4A5A6A7"
+	fixedEkRndB    = "C2E5CFEF635C603D"                 // ek(RndB), IV 0
+	fixedEkRndAB   = "0A522DAACD1ED0EE037312217EEEFB6A" // ek(RndA || RndB'), IV ek(RndB)
+	fixedEkRndARot = "7BA8A8FBE882C212"                 // ek(RndA'), IV the last block above
+)
+
+func (c *fixedAuthCard) transceive(frame []byte, lastBits byte) (resp []byte, bits byte) {
+	switch {
+	case len(frame) == 4 && frame[0] == commands.PICC_UL_AUTH:
+		enc, _ := hex.DecodeString(fixedEkRndB)
+		return withCRC(append([]byte{commands.PICC_UL_AUTH_CONT}, enc...)...), 0
+	case len(frame) == 19 && frame[0] == commands.PICC_UL_AUTH_CONT:
+		if hex.EncodeToString(frame[1:17]) != strings.ToLower(fixedEkRndAB) {
+			return []byte{0x00}, 4
+		}
+		enc, _ := hex.DecodeString(fixedEkRndARot)
+		return withCRC(append([]byte{0x00}, enc...)...), 0
+	}
+	return c.ultralightCard.transceive(frame, lastBits)
+}
+
+func TestUltralightAuthenticationExchange(t *testing.T) {
+	rndA, _ := hex.DecodeString(fixedRndA)
+	random = bytes.NewReader(rndA)
+	defer func() { random = rand.Reader }()
+
+	card := &fixedAuthCard{newUltralightCard([]byte{0x04, 1, 2, 3, 4, 5, 6})}
+	r, chip := newFakeRFID(card)
+	err := r.WithUltralight(func(tag *Ultralight) error {
+		return tag.Authenticate(DefaultUltralightCKey)
+	})
+	assert.NoError(t, err)
+	last := chip.sent[len(chip.sent)-1]
+	assert.Equal(t, fixedEkRndAB, strings.ToUpper(hex.EncodeToString(last[1:17])))
+}
+
+func TestKeyPages(t *testing.T) {
+	pages := keyPages(DefaultUltralightCKey)
+	var stored []byte
+	for _, p := range pages {
+		stored = append(stored, p[:]...)
+	}
+	assert.Equal(t, "BREAKMEIFYOUCAN!", string(stored))
+}
+
+func TestUltralightPages(t *testing.T) {
+	uid := []byte{0x04, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66}
+	card := newUltralightCard(uid)
+	copy(card.pages[4][:], []byte{0xCA, 0xFE, 0xBA, 0xBE})
+	r, _ := newFakeRFID(card)
+
+	err := r.WithUltralight(func(tag *Ultralight) (err error) {
+		assert.Equal(t, uid, tag.UID())
+		data, err := tag.ReadPages(4)
+		if err != nil {
+			return
+		}
+		assert.Equal(t, []byte{0xCA, 0xFE, 0xBA, 0xBE}, data[0:4])
+		err = tag.WritePage(5, [4]byte{1, 2, 3, 4})
+		if err != nil {
+			return
+		}
+		data, err = tag.ReadPages(4)
+		if err != nil {
+			return
+		}
+		assert.Equal(t, []byte{1, 2, 3, 4}, data[4:8])
+		assert.Error(t, tag.WritePage(0, [4]byte{}), "UID page is read only")
+		return
+	})
+	assert.NoError(t, err)
+}
+
+func TestUltralightAuthentication(t *testing.T) {
+	card := newUltralightCard([]byte{0x04, 1, 2, 3, 4, 5, 6})
+	r, _ := newFakeRFID(card)
+	newKey := []byte("0123456789ABCDEF")
+
+	err := r.WithUltralight(func(tag *Ultralight) error {
+		return tag.Authenticate(newKey)
+	})
+	assert.Error(t, err, "wrong key")
+
+	err = r.WithUltralight(func(tag *Ultralight) (err error) {
+		err = tag.Authenticate(DefaultUltralightCKey)
+		if err != nil {
+			return
+		}
+		err = tag.WriteKey(newKey)
+		if err != nil {
+			return
+		}
+		err = tag.SetProtection(0x10, false)
+		return
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, newKey, card.key())
+
+	err = r.WithUltralight(func(tag *Ultralight) (err error) {
+		_, err = tag.ReadPages(0x10)
+		assert.Error(t, err, "page is protected")
+		return nil
+	})
+	assert.NoError(t, err)
+
+	err = r.WithUltralight(func(tag *Ultralight) (err error) {
+		err = tag.Authenticate(newKey)
+		if err != nil {
+			return
+		}
+		_, err = tag.ReadPages(0x10)
+		return
+	})
+	assert.NoError(t, err)
+}
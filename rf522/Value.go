@@ -0,0 +1,184 @@
+package rf522
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/sirupsen/logrus"
+)
+
+// EncodeValue builds a value block: the value is stored three times (once
+// inverted) followed by the address byte stored four times (twice inverted)
+func EncodeValue(value int32, addr byte) (data [16]byte) {
+	v := uint32(value)
+	binary.LittleEndian.PutUint32(data[0:], v)
+	binary.LittleEndian.PutUint32(data[4:], ^v)
+	binary.LittleEndian.PutUint32(data[8:], v)
+	data[12] = addr
+	data[13] = ^addr
+	data[14] = addr
+	data[15] = ^addr
+	return
+}
+
+// DecodeValue checks the redundancy of a value block and returns its content
+func DecodeValue(data []byte) (value int32, addr byte, err error) {
+	if len(data) != 16 {
+		err = errors.New(fmt.Sprintf("value block must be 16 bytes, got %d", len(data)))
+		return
+	}
+	v := binary.LittleEndian.Uint32(data[0:])
+	if binary.LittleEndian.Uint32(data[4:]) != ^v || binary.LittleEndian.Uint32(data[8:]) != v ||
+		data[13] != ^data[12] || data[14] != data[12] || data[15] != ^data[12] {
+		err = errors.New(fmt.Sprintf("not a value block: %s", printBytes(data)))
+		return
+	}
+	value = int32(v)
+	addr = data[12]
+	return
+}
+
+// valueOp runs increment, decrement or restore: the card acknowledges the
+// command and stays silent after the operand
+func (r *RFID) valueOp(cmd byte, blockAddr byte, operand int32) (err error) {
+	read, backLen, err := r.preAccess(blockAddr, cmd)
+	if err != nil || backLen != 4 || read[0]&0x0F != 0x0A {
+		logrus.Warn("Can not grant value operation on block ", read, backLen, err)
+		if err == nil {
+			err = errors.New(fmt.Sprintf("can not grant value operation on block %d", blockAddr))
+		}
+		return
+	}
+	data := make([]byte, 4)
+	binary.LittleEndian.PutUint32(data, uint32(operand))
+	crc, err := r.crc(data)
+	if err != nil {
+		return
+	}
+	read, backLen, err = r.cardWrite(commands.PCD_TRANSCEIVE, append(data, crc...))
+	if err == ErrTimeout {
+		err = nil
+		return
+	}
+	if err == nil {
+		err = errors.New(fmt.Sprintf("value operation on block %d refused", blockAddr))
+	}
+	return
+}
+
+// transfer writes the internal register of the card to the block
+func (r *RFID) transfer(blockAddr byte) (err error) {
+	read, backLen, err := r.preAccess(blockAddr, commands.PICC_TRANSFER)
+	if err != nil {
+		return
+	}
+	if backLen != 4 || read[0]&0x0F != 0x0A {
+		err = errors.New(fmt.Sprintf("can not transfer to block %d", blockAddr))
+	}
+	return
+}
+
+func checkValueBlock(sector, block int) (err error) {
+	if block < 0 || block > 2 {
+		err = errors.New(fmt.Sprintf("block %d can't hold a value", block))
+		return
+	}
+	err = checkBlockAddress(sector*BlocksPerSector + block)
+	return
+}
+
+// ReadValue reads the value block
+func (r *RFID) ReadValue(auth byte, sector, block int, key []byte) (value int32, err error) {
+	if err = checkValueBlock(sector, block); err != nil {
+		return
+	}
+	err = r.withSession(auth, key, func(s *sectorSession) (err error) {
+		err = s.enter(sector)
+		if err != nil {
+			return
+		}
+		data, err := r.read(calcBlockAddress(sector, block))
+		if err != nil {
+			return
+		}
+		value, _, err = DecodeValue(data)
+		return
+	})
+	return
+}
+
+// WriteValue formats the block as a value block holding the value
+func (r *RFID) WriteValue(auth byte, sector, block int, value int32, key []byte) (err error) {
+	if err = checkValueBlock(sector, block); err != nil {
+		return
+	}
+	addr := calcBlockAddress(sector, block)
+	data := EncodeValue(value, addr)
+	err = r.withSession(auth, key, func(s *sectorSession) (err error) {
+		err = s.enter(sector)
+		if err != nil {
+			return
+		}
+		err = r.write(addr, data[:])
+		return
+	})
+	return
+}
+
+func (r *RFID) changeValue(cmd byte, auth byte, sector, block int, operand int32, key []byte) (err error) {
+	if err = checkValueBlock(sector, block); err != nil {
+		return
+	}
+	addr := calcBlockAddress(sector, block)
+	err = r.withSession(auth, key, func(s *sectorSession) (err error) {
+		err = s.enter(sector)
+		if err != nil {
+			return
+		}
+		err = r.valueOp(cmd, addr, operand)
+		if err != nil {
+			return
+		}
+		err = r.transfer(addr)
+		return
+	})
+	return
+}
+
+// IncrementValue adds delta to the value block
+func (r *RFID) IncrementValue(auth byte, sector, block int, delta int32, key []byte) (err error) {
+	err = r.changeValue(commands.PICC_INCREMENT, auth, sector, block, delta, key)
+	return
+}
+
+// DecrementValue subtracts delta from the value block
+func (r *RFID) DecrementValue(auth byte, sector, block int, delta int32, key []byte) (err error) {
+	err = r.changeValue(commands.PICC_DECREMENT, auth, sector, block, delta, key)
+	return
+}
+
+// CopyValue copies a value block to another block of the same sector using
+// restore and transfer, e.g. to keep a backup of a purse
+func (r *RFID) CopyValue(auth byte, sector, from, to int, key []byte) (err error) {
+	if err = checkValueBlock(sector, from); err != nil {
+		return
+	}
+	if err = checkValueBlock(sector, to); err != nil {
+		return
+	}
+	err = r.withSession(auth, key, func(s *sectorSession) (err error) {
+		err = s.enter(sector)
+		if err != nil {
+			return
+		}
+		err = r.valueOp(commands.PICC_RESTORE, calcBlockAddress(sector, from), 0)
+		if err != nil {
+			return
+		}
+		err = r.transfer(calcBlockAddress(sector, to))
+		return
+	})
+	return
+}
@@ -0,0 +1,62 @@
+package rf522
+
+import (
+	"testing"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeValue(t *testing.T) {
+	data := EncodeValue(1234567, 5)
+	assert.Equal(t, [16]byte{
+		0x87, 0xD6, 0x12, 0x00, 0x78, 0x29, 0xED, 0xFF, 0x87, 0xD6, 0x12, 0x00, 0x05, 0xFA, 0x05, 0xFA,
+	}, data)
+	value, addr, err := DecodeValue(data[:])
+	assert.NoError(t, err)
+	assert.Equal(t, int32(1234567), value)
+	assert.Equal(t, byte(5), addr)
+
+	negative := EncodeValue(-100, 0)
+	value, _, err = DecodeValue(negative[:])
+	assert.NoError(t, err)
+	assert.Equal(t, int32(-100), value)
+
+	data[4] = 0
+	_, _, err = DecodeValue(data[:])
+	assert.Error(t, err)
+	_, _, err = DecodeValue(data[:4])
+	assert.Error(t, err)
+}
+
+func TestValueOperations(t *testing.T) {
+	card := newClassicCard([]byte{1, 2, 3, 4})
+	r, _ := newFakeRFID(card)
+
+	assert.NoError(t, r.WriteValue(commands.PICC_AUTHENT1A, 2, 1, 100, DefaultKey))
+	assert.Equal(t, EncodeValue(100, 9), card.blocks[9])
+
+	assert.NoError(t, r.IncrementValue(commands.PICC_AUTHENT1A, 2, 1, 50, DefaultKey))
+	assert.NoError(t, r.DecrementValue(commands.PICC_AUTHENT1A, 2, 1, 30, DefaultKey))
+	value, err := r.ReadValue(commands.PICC_AUTHENT1A, 2, 1, DefaultKey)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(120), value)
+
+	assert.NoError(t, r.CopyValue(commands.PICC_AUTHENT1A, 2, 1, 2, DefaultKey))
+	value, err = r.ReadValue(commands.PICC_AUTHENT1A, 2, 2, DefaultKey)
+	assert.NoError(t, err)
+	assert.Equal(t, int32(120), value)
+
+	_, err = r.ReadValue(commands.PICC_AUTHENT1A, 2, 0, DefaultKey)
+	assert.Error(t, err, "block 0 is not a value block")
+	assert.Error(t, r.IncrementValue(commands.PICC_AUTHENT1A, 2, 3, 1, DefaultKey))
+}
+
+func TestValueWrongKey(t *testing.T) {
+	card := newClassicCard([]byte{1, 2, 3, 4})
+	r, _ := newFakeRFID(card)
+	err := r.IncrementValue(commands.PICC_AUTHENT1A, 2, 1, 1, []byte{1, 2, 3, 4, 5, 6})
+	if assert.IsType(t, &AuthError{}, err) {
+		assert.Equal(t, 2, err.(*AuthError).Sector)
+	}
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522"
+	"github.com/jdevelop/gpio"
+	rpio "github.com/jdevelop/gpio/rpi"
+	"github.com/sirupsen/logrus"
+)
+
+// output is a GPIO line that is switched on for a while
+type output struct {
+	pin gpio.Pin
+	mu  sync.Mutex
+}
+
+func openOutput(n int) (o *output, err error) {
+	if n < 0 {
+		return
+	}
+	pin, err := rpio.OpenPin(n, gpio.ModeOutput)
+	if err != nil {
+		return
+	}
+	pin.Clear()
+	o = &output{pin: pin}
+	return
+}
+
+// pattern switches the line on and off for the given durations, starting with on
+func (o *output) pattern(durations ...time.Duration) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i, d := range durations {
+		if i%2 == 0 {
+			o.pin.Set()
+		} else {
+			o.pin.Clear()
+		}
+		time.Sleep(d)
+	}
+	o.pin.Clear()
+}
+
+func (o *output) close() {
+	if o != nil {
+		o.pin.Clear()
+		o.pin.Close()
+	}
+}
+
+// auditLog appends one line per card to the log file
+type auditLog struct {
+	f *os.File
+}
+
+func openAuditLog(path string) (a *auditLog, err error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return
+	}
+	a = &auditLog{f: f}
+	return
+}
+
+func (a *auditLog) record(uid []byte, granted bool, name string) (err error) {
+	decision := "DENIED"
+	if granted {
+		decision = "GRANTED"
+	}
+	_, err = fmt.Fprintf(a.f, "%s\t%s\t%s\t%s\n", time.Now().Format(time.RFC3339), uidKey(uid), decision, name)
+	if err != nil {
+		return
+	}
+	err = a.f.Sync()
+	return
+}
+
+func (a *auditLog) close() {
+	if err := a.f.Close(); err != nil {
+		logrus.Error("Can not close audit log: ", err)
+	}
+}
+
+var (
+	bus       = flag.Int("bus", 0, "SPI bus")
+	device    = flag.Int("device", 0, "SPI device (chip select)")
+	speed     = flag.Int("speed", 1000000, "SPI speed, Hz")
+	resetPin  = flag.Int("reset", 25, "reader reset pin")
+	irqPin    = flag.Int("irq", 24, "reader IRQ pin")
+	allowPath = flag.String("allow", "/etc/rf522/allowlist", "allowlist file, one hex UID and optional name per line")
+	auditPath = flag.String("audit", "/var/log/rf522-access.log", "audit log file")
+	relayPin  = flag.Int("relay", 17, "relay pin")
+	openTime  = flag.Duration("open", 3*time.Second, "how long the relay stays on")
+	buzzerPin = flag.Int("buzzer", -1, "buzzer pin, -1 to disable")
+	ledPin    = flag.Int("led", -1, "denial LED pin, -1 to disable")
+	holdOff   = flag.Duration("holdoff", 2*time.Second, "ignore the same card for this long")
+	debug     = flag.Bool("debug", false, "debug logging")
+)
+
+func main() {
+
+	flag.Parse()
+
+	if *debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	// a reader failure exits with 1, so the service manager restarts the daemon
+	if err := run(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run() (err error) {
+	allowed, err := loadAllowList(*allowPath)
+	if err != nil {
+		return
+	}
+	audit, err := openAuditLog(*auditPath)
+	if err != nil {
+		return
+	}
+	defer audit.close()
+	relay, err := openOutput(*relayPin)
+	if err != nil {
+		return
+	}
+	defer relay.close()
+	buzzer, err := openOutput(*buzzerPin)
+	if err != nil {
+		return
+	}
+	defer buzzer.close()
+	led, err := openOutput(*ledPin)
+	if err != nil {
+		return
+	}
+	defer led.close()
+
+	// use BCM numbering here
+	rfid, err := rf522.MakeRFID(*bus, *device, *speed, *resetPin, *irqPin)
+	if err != nil {
+		return
+	}
+	// closed by a signal or on the way out, whatever comes first
+	var closeOnce sync.Once
+	closeReader := func() {
+		closeOnce.Do(func() { rfid.Close() })
+	}
+	defer closeReader()
+
+	stop := make(chan interface{})
+	go allowed.watch(2*time.Second, stop)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		close(stop)
+		closeReader()
+	}()
+
+	// returns an error when the reader is closed or fails
+	err = rf522.Cards(rfid, *holdOff, func(uid []byte) error {
+		name, ok := allowed.lookup(uid)
+		if err := audit.record(uid, ok, name); err != nil {
+			logrus.Error("Can not write audit log: ", err)
+		}
+		if ok {
+			logrus.Info("Access granted to ", uidKey(uid), " ", name)
+			go relay.pattern(*openTime)
+		} else {
+			logrus.Warn("Access denied to ", uidKey(uid))
+			go buzzer.pattern(100*time.Millisecond, 100*time.Millisecond, 100*time.Millisecond,
+				100*time.Millisecond, 100*time.Millisecond)
+			go led.pattern(time.Second)
+		}
+		return nil
+	})
+	select {
+	case <-stop:
+		logrus.Info("Reader stopped")
+		err = nil
+	default:
+		err = errors.New(fmt.Sprintf("reader failed: %v", err))
+	}
+	return
+}
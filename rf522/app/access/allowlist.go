@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// allowList maps the UID in upper case hex to the card holder name
+type allowList map[string]string
+
+func uidKey(uid []byte) string {
+	return strings.ToUpper(hex.EncodeToString(uid))
+}
+
+// parseAllowList reads one card per line: the UID in hex, optionally with
+// ':' separators, followed by spaces or tabs and the card holder name. Empty lines and lines
+// starting with '#' are skipped.
+func parseAllowList(r io.Reader) (list allowList, err error) {
+	list = make(allowList)
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key := strings.Fields(text)[0]
+		uid, err1 := hex.DecodeString(strings.Replace(key, ":", "", -1))
+		if err1 != nil || len(uid) == 0 {
+			err = errors.New(fmt.Sprintf("line %d: bad UID %s", line, key))
+			return
+		}
+		// the name keeps its inner spacing
+		list[uidKey(uid)] = strings.TrimSpace(text[len(key):])
+	}
+	err = scanner.Err()
+	return
+}
+
+// watchedAllowList reloads the file whenever its modification time changes
+type watchedAllowList struct {
+	path    string
+	mu      sync.RWMutex
+	list    allowList
+	modTime time.Time
+	// failed is the modification time of the broken file, it is not read
+	// again until it changes
+	failed time.Time
+}
+
+func loadAllowList(path string) (w *watchedAllowList, err error) {
+	w = &watchedAllowList{path: path}
+	_, err = w.reload()
+	return
+}
+
+func (w *watchedAllowList) reload() (reloaded bool, err error) {
+	info, err := os.Stat(w.path)
+	if err != nil || info.ModTime().Equal(w.modTime) || info.ModTime().Equal(w.failed) {
+		return
+	}
+	defer func() {
+		if err != nil {
+			w.failed = info.ModTime()
+		}
+	}()
+	f, err := os.Open(w.path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	list, err := parseAllowList(f)
+	if err != nil {
+		return
+	}
+	w.mu.Lock()
+	w.list = list
+	w.modTime = info.ModTime()
+	w.mu.Unlock()
+	reloaded = true
+	return
+}
+
+// watch checks the file every interval until stop is closed. A broken file
+// keeps the previous list active, the error is logged once.
+func (w *watchedAllowList) watch(interval time.Duration, stop <-chan interface{}) {
+	logged := ""
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(interval):
+		}
+		reloaded, err := w.reload()
+		switch {
+		case err != nil && err.Error() != logged:
+			logrus.Error("Can not reload allowlist: ", err)
+			logged = err.Error()
+		case err == nil:
+			logged = ""
+			if reloaded {
+				logrus.Info("Allowlist reloaded from ", w.path)
+			}
+		}
+	}
+}
+
+func (w *watchedAllowList) lookup(uid []byte) (name string, ok bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	name, ok = w.list[uidKey(uid)]
+	return
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAllowList(t *testing.T) {
+	list, err := parseAllowList(strings.NewReader(`
+# staff
+DE:AD:BE:EF  John Doe
+0102030405060a
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, allowList{
+		"DEADBEEF":       "John Doe",
+		"0102030405060A": "",
+	}, list)
+
+	_, err = parseAllowList(strings.NewReader("XYZ"))
+	assert.Error(t, err)
+}
+
+func TestParseAllowListSpacing(t *testing.T) {
+	list, err := parseAllowList(strings.NewReader("DEADBEEF\tJohn  Doe\n  01020304   \t Jane\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, allowList{"DEADBEEF": "John  Doe", "01020304": "Jane"}, list)
+}
+
+func TestReloadAllowList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "allowlist")
+	write := func(text string, age time.Duration) {
+		assert.NoError(t, os.WriteFile(path, []byte(text), 0600))
+		stamp := time.Now().Add(-age)
+		assert.NoError(t, os.Chtimes(path, stamp, stamp))
+	}
+	write("DEADBEEF John\n", time.Hour)
+	w, err := loadAllowList(path)
+	assert.NoError(t, err)
+	_, ok := w.lookup([]byte{0xDE, 0xAD, 0xBE, 0xEF})
+	assert.True(t, ok)
+
+	reloaded, err := w.reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded, "not changed")
+
+	write("01020304 Jane\n", 2*time.Hour)
+	reloaded, err = w.reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded, "an older file is a change too")
+	name, ok := w.lookup([]byte{1, 2, 3, 4})
+	assert.True(t, ok)
+	assert.Equal(t, "Jane", name)
+
+	// a broken file is reported once and keeps the previous list
+	write("XYZ\n", 3*time.Hour)
+	_, err = w.reload()
+	assert.Error(t, err)
+	reloaded, err = w.reload()
+	assert.NoError(t, err)
+	assert.False(t, reloaded)
+	_, ok = w.lookup([]byte{1, 2, 3, 4})
+	assert.True(t, ok)
+
+	write("XYZ\n", 4*time.Hour)
+	_, err = w.reload()
+	assert.Error(t, err, "changed again")
+
+	write("DEADBEEF\n", 5*time.Hour)
+	reloaded, err = w.reload()
+	assert.NoError(t, err)
+	assert.True(t, reloaded)
+	_, ok = w.lookup([]byte{1, 2, 3, 4})
+	assert.False(t, ok)
+}
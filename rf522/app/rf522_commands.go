@@ -0,0 +1,523 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522"
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/jdevelop/golang-rpi-extras/rf522/ndef"
+	"github.com/jdevelop/golang-rpi-extras/rf522/provision"
+	"github.com/jdevelop/golang-rpi-extras/wedge"
+)
+
+var handlers = map[string]func(c *cli, args []string) error{
+	"info":      info,
+	"read":      read,
+	"write":     write,
+	"dump":      dump,
+	"restore":   restore,
+	"trailer":   trailer,
+	"value":     value,
+	"ndef":      ndefRecords,
+	"watch":     watch,
+	"selftest":  selfTest,
+	"registers": registers,
+	"provision": provisionCards,
+	"wedge":     keyboardWedge,
+}
+
+func argCount(args []string, min, max int) (err error) {
+	if len(args) < min || len(args) > max {
+		err = usageError("wrong number of arguments")
+	}
+	return
+}
+
+func parseNumber(s string, min, max int, what string) (n int, err error) {
+	n, err = strconv.Atoi(s)
+	if err != nil || n < min || n > max {
+		err = usageError("%s must be %d..%d, got %s", what, min, max, s)
+	}
+	return
+}
+
+func parseBlock(s string) (int, error) {
+	return parseNumber(s, 0, rf522.SectorCount*rf522.BlocksPerSector-1, "block")
+}
+
+func info(c *cli, args []string) (err error) {
+	if err = argCount(args, 0, 0); err != nil {
+		return
+	}
+	version, err := c.rfid.Version()
+	if err != nil {
+		return &cliError{code: exitDevice, err: err}
+	}
+	var uid []byte
+	err = c.card(func() (err error) {
+		if err = c.rfid.Wait(); err != nil {
+			return
+		}
+		uid, err = c.rfid.ReadUID()
+		return
+	})
+	if err != nil {
+		return
+	}
+	err = c.emit(struct {
+		Version hexBytes `json:"version"`
+		UID     hexBytes `json:"uid"`
+	}{hexBytes{version}, uid}, fmt.Sprintf("version %02X\nuid %X\n", version, uid))
+	return
+}
+
+type block struct {
+	Block int      `json:"block"`
+	Data  hexBytes `json:"data"`
+}
+
+func (c *cli) emitBlocks(blocks []block) (err error) {
+	var text bytes.Buffer
+	for _, b := range blocks {
+		fmt.Fprintf(&text, "%02d %X\n", b.Block, []byte(b.Data))
+	}
+	err = c.emit(blocks, text.String())
+	return
+}
+
+func read(c *cli, args []string) (err error) {
+	if err = argCount(args, 1, 1); err != nil {
+		return
+	}
+	addr, err := parseBlock(args[0])
+	if err != nil {
+		return
+	}
+	var data [][]byte
+	err = c.card(func() (err error) {
+		data, err = c.rfid.ReadBlocks(c.auth, []int{addr}, c.key)
+		return
+	})
+	if err != nil {
+		return
+	}
+	err = c.emitBlocks([]block{{addr, data[0]}})
+	return
+}
+
+func write(c *cli, args []string) (err error) {
+	if err = argCount(args, 2, 2); err != nil {
+		return
+	}
+	addr, err := parseBlock(args[0])
+	if err != nil {
+		return
+	}
+	data, err := parseHex(args[1])
+	if err != nil || len(data) != 16 {
+		return usageError("data must be 16 bytes in hex")
+	}
+	b := rf522.BlockData{Address: addr}
+	copy(b.Data[:], data)
+	err = c.card(func() error {
+		return c.rfid.WriteBlocks(c.auth, []rf522.BlockData{b}, c.key)
+	})
+	return
+}
+
+func dump(c *cli, args []string) (err error) {
+	if err = argCount(args, 0, 0); err != nil {
+		return
+	}
+	addrs := make([]int, rf522.SectorCount*rf522.BlocksPerSector)
+	for i := range addrs {
+		addrs[i] = i
+	}
+	var data [][]byte
+	err = c.card(func() (err error) {
+		data, err = c.rfid.ReadBlocks(c.auth, addrs, c.key)
+		return
+	})
+	if err != nil {
+		return
+	}
+	blocks := make([]block, len(data))
+	for i, d := range data {
+		blocks[i] = block{i, d}
+	}
+	err = c.emitBlocks(blocks)
+	return
+}
+
+// parseDump accepts both the hex and the JSON output of dump
+func parseDump(content []byte) (blocks []block, err error) {
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '[' {
+		err = json.Unmarshal(trimmed, &blocks)
+		return
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			err = errors.New(fmt.Sprintf("line %d: block and data expected", line))
+			return
+		}
+		var b block
+		b.Block, err = parseBlock(fields[0])
+		if err != nil {
+			return
+		}
+		b.Data, err = parseHex(fields[1])
+		if err != nil {
+			return
+		}
+		blocks = append(blocks, b)
+	}
+	err = scanner.Err()
+	return
+}
+
+func restore(c *cli, args []string) (err error) {
+	if err = argCount(args, 1, 1); err != nil {
+		return
+	}
+	content, err := ioutil.ReadFile(args[0])
+	if err != nil {
+		return &cliError{code: exitFailure, err: err}
+	}
+	blocks, err := parseDump(content)
+	if err != nil {
+		return usageError("bad dump: %v", err)
+	}
+	var data []rf522.BlockData
+	for _, b := range blocks {
+		// manufacturer block and sector trailers are left alone
+		if b.Block == 0 || b.Block%rf522.BlocksPerSector == 3 {
+			continue
+		}
+		if len(b.Data) != 16 {
+			return usageError("block %d must be 16 bytes", b.Block)
+		}
+		d := rf522.BlockData{Address: b.Block}
+		copy(d.Data[:], b.Data)
+		data = append(data, d)
+	}
+	err = c.card(func() error {
+		return c.rfid.WriteBlocks(c.auth, data, c.key)
+	})
+	return
+}
+
+func parseAccess(s string) (access *rf522.BlocksAccess, err error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		err = usageError("access must be 4 numbers 0..7")
+		return
+	}
+	bits := make([]int, 4)
+	for i, p := range parts {
+		if bits[i], err = parseNumber(p, 0, 7, "access bits"); err != nil {
+			return
+		}
+	}
+	access = &rf522.BlocksAccess{
+		B0: rf522.BlockAccess(bits[0]),
+		B1: rf522.BlockAccess(bits[1]),
+		B2: rf522.BlockAccess(bits[2]),
+		B3: rf522.SectorTrailerAccess(bits[3]),
+	}
+	return
+}
+
+func trailer(c *cli, args []string) (err error) {
+	if len(args) != 1 && len(args) != 4 {
+		return usageError("wrong number of arguments")
+	}
+	sector, err := parseNumber(args[0], 0, rf522.SectorCount-1, "sector")
+	if err != nil {
+		return
+	}
+	if len(args) == 4 {
+		var keyA, keyB [6]byte
+		a, err1 := parseKey(args[1])
+		if err1 != nil {
+			return usageError("bad key A: %v", err1)
+		}
+		b, err1 := parseKey(args[2])
+		if err1 != nil {
+			return usageError("bad key B: %v", err1)
+		}
+		copy(keyA[:], a)
+		copy(keyB[:], b)
+		access, err1 := parseAccess(args[3])
+		if err1 != nil {
+			return err1
+		}
+		err = c.card(func() error {
+			return c.rfid.WriteSectorTrail(c.auth, sector, keyA, keyB, access, c.key)
+		})
+		return
+	}
+	var data []byte
+	err = c.card(func() (err error) {
+		data, err = c.rfid.ReadAuth(c.auth, sector, c.key)
+		return
+	})
+	if err != nil {
+		return
+	}
+	access := rf522.ParseBlockAccess(data[6:10])
+	err = c.emit(struct {
+		KeyA   hexBytes `json:"keyA"`
+		Access []int    `json:"access"`
+		KeyB   hexBytes `json:"keyB"`
+	}{
+		data[0:6], []int{int(access.B0), int(access.B1), int(access.B2), int(access.B3)}, data[10:16],
+	}, fmt.Sprintf("keyA %X\naccess %d,%d,%d,%d\nkeyB %X\n",
+		data[0:6], access.B0, access.B1, access.B2, access.B3, data[10:16]))
+	return
+}
+
+func value(c *cli, args []string) (err error) {
+	if err = argCount(args, 1, 3); err != nil {
+		return
+	}
+	addr, err := parseBlock(args[0])
+	if err != nil {
+		return
+	}
+	sector, blk := addr/rf522.BlocksPerSector, addr%rf522.BlocksPerSector
+	op := "get"
+	if len(args) > 1 {
+		op = args[1]
+	}
+	if (op == "get") != (len(args) < 3) {
+		return usageError("wrong number of arguments")
+	}
+	var n int
+	if op == "copy" {
+		n, err = parseBlock(args[2])
+		if err == nil && n/rf522.BlocksPerSector != sector {
+			err = usageError("block %d is in another sector", n)
+		}
+	} else if op != "get" {
+		n, err = strconv.Atoi(args[2])
+		if err != nil {
+			err = usageError("bad number %s", args[2])
+		}
+	}
+	if err != nil {
+		return
+	}
+	switch op {
+	case "get":
+	case "set":
+		err = c.card(func() error {
+			return c.rfid.WriteValue(c.auth, sector, blk, int32(n), c.key)
+		})
+	case "inc":
+		err = c.card(func() error {
+			return c.rfid.IncrementValue(c.auth, sector, blk, int32(n), c.key)
+		})
+	case "dec":
+		err = c.card(func() error {
+			return c.rfid.DecrementValue(c.auth, sector, blk, int32(n), c.key)
+		})
+	case "copy":
+		err = c.card(func() error {
+			return c.rfid.CopyValue(c.auth, sector, blk, n%rf522.BlocksPerSector, c.key)
+		})
+		addr = n
+		sector, blk = addr/rf522.BlocksPerSector, addr%rf522.BlocksPerSector
+	default:
+		return usageError("unknown value operation %s", op)
+	}
+	if err != nil {
+		return
+	}
+	var v int32
+	err = c.card(func() (err error) {
+		v, err = c.rfid.ReadValue(c.auth, sector, blk, c.key)
+		return
+	})
+	if err != nil {
+		return
+	}
+	err = c.emit(struct {
+		Block int   `json:"block"`
+		Value int32 `json:"value"`
+	}{addr, v}, fmt.Sprintf("%02d %d\n", addr, v))
+	return
+}
+
+type ndefRecord struct {
+	TNF         byte     `json:"tnf"`
+	Type        string   `json:"type"`
+	ID          hexBytes `json:"id,omitempty"`
+	Payload     hexBytes `json:"payload"`
+	Description string   `json:"description"`
+}
+
+func ndefRecords(c *cli, args []string) (err error) {
+	if err = argCount(args, 0, 0); err != nil {
+		return
+	}
+	var messages [][]ndef.Record
+	err = c.card(func() (err error) {
+		messages, err = ndef.ReadMessages(c.rfid)
+		return
+	})
+	if err != nil {
+		return
+	}
+	var records []ndefRecord
+	var text bytes.Buffer
+	for i, m := range messages {
+		for _, r := range m {
+			records = append(records, ndefRecord{r.TNF, string(r.Type), r.ID, r.Payload, r.String()})
+			fmt.Fprintf(&text, "%d %s\n", i, r.String())
+		}
+	}
+	err = c.emit(records, text.String())
+	return
+}
+
+// watchHoldOff is the time a card has to be out of the field to be
+// reported again
+const watchHoldOff = time.Second
+
+func watch(c *cli, args []string) (err error) {
+	if err = argCount(args, 0, 0); err != nil {
+		return
+	}
+	// a card kept in the field is reported once
+	err = rf522.Cards(c.rfid, watchHoldOff, func(uid []byte) (err error) {
+		now := time.Now()
+		err = c.emit(struct {
+			Time time.Time `json:"time"`
+			UID  hexBytes  `json:"uid"`
+		}{now, uid}, fmt.Sprintf("%s %X\n", now.Format(time.RFC3339), uid))
+		if err != nil {
+			err = &cliError{code: exitFailure, err: err}
+		}
+		return
+	})
+	return
+}
+
+func selfTest(c *cli, args []string) (err error) {
+	if err = argCount(args, 0, 0); err != nil {
+		return
+	}
+	version, err := c.rfid.SelfTest()
+	passed := err == nil
+	if err1 := c.emit(struct {
+		Version hexBytes `json:"version"`
+		Passed  bool     `json:"passed"`
+	}{hexBytes{version}, passed}, fmt.Sprintf("version %02X\npassed %v\n", version, passed)); err1 != nil {
+		return &cliError{code: exitFailure, err: err1}
+	}
+	if err != nil {
+		err = &cliError{code: exitSelfTest, err: err}
+	}
+	return
+}
+
+func registers(c *cli, args []string) (err error) {
+	if err = argCount(args, 0, 0); err != nil {
+		return
+	}
+	dump, err := c.rfid.DumpRegisters()
+	if err != nil {
+		return &cliError{code: exitDevice, err: err}
+	}
+	regs := make(map[string]hexBytes)
+	for i, v := range dump {
+		regs[commands.RegisterName(byte(i))] = hexBytes{v}
+	}
+	err = c.emit(regs, dump.String())
+	return
+}
+
+func provisionCards(c *cli, args []string) (err error) {
+	if err = argCount(args, 1, 2); err != nil {
+		return
+	}
+	count := 1
+	if len(args) == 2 {
+		if count, err = parseNumber(args[1], 0, 1<<30, "count"); err != nil {
+			return
+		}
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return &cliError{code: exitFailure, err: err}
+	}
+	tmpl, err := provision.ParseTemplate(f)
+	f.Close()
+	if err != nil {
+		return usageError("bad template: %v", err)
+	}
+	failed := 0
+	err = tmpl.Batch(provision.NewReader(c.rfid), count, func(res *provision.Result) {
+		var text bytes.Buffer
+		status := "OK"
+		if !res.OK {
+			status = "FAILED"
+			failed++
+		}
+		fmt.Fprintf(&text, "%s %s\n", res.UID, status)
+		for _, s := range res.Sectors {
+			if s.Error != "" {
+				fmt.Fprintf(&text, "  sector %d: %s\n", s.Sector, s.Error)
+			}
+		}
+		c.emit(res, text.String())
+	})
+	if err == nil && failed > 0 {
+		err = &cliError{code: exitCard, err: errors.New(fmt.Sprintf("%d cards failed", failed))}
+	}
+	return
+}
+
+func keyboardWedge(c *cli, args []string) (err error) {
+	if err = argCount(args, 0, 3); err != nil {
+		return
+	}
+	format, reverse, enter := wedge.Hex, false, true
+	for _, a := range args {
+		switch a {
+		case "hex":
+			format = wedge.Hex
+		case "decimal":
+			format = wedge.Decimal
+		case "reverse":
+			reverse = true
+		case "noenter":
+			enter = false
+		default:
+			return usageError("unknown wedge option %s", a)
+		}
+	}
+	// the options are checked before the virtual keyboard shows up
+	k, err := wedge.NewKeyboard("rf522 keyboard wedge")
+	if err != nil {
+		return &cliError{code: exitDevice, err: err}
+	}
+	defer k.Close()
+	k.Format, k.Reverse, k.Enter = format, reverse, enter
+	err = wedge.Forward(c.rfid, k, time.Second)
+	return
+}
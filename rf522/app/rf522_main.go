@@ -1,82 +1,244 @@
 package main
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"os"
+	"strings"
+	"time"
+
 	"github.com/jdevelop/golang-rpi-extras/rf522"
 	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
 	"github.com/sirupsen/logrus"
-	"log"
-	"os"
-	"strconv"
 )
 
-func main() {
+// exit codes
+const (
+	exitOK = iota
+	exitFailure
+	exitUsage
+	exitDevice   // the reader can't be opened
+	exitNoCard   // no card showed up before the timeout
+	exitAuth     // the card refused the key
+	exitCard     // the card didn't answer as expected
+	exitSelfTest // the chip failed the self test
+)
+
+const usage = `Usage: rf522 [flags] <command> [arguments]
 
-	//currentAccessKey := [6]byte{1, 2, 3, 4, 5, 6}
-	currentAccessKey := [6]byte{6, 5, 4, 3, 2, 1}
-	currentAccessMethod := byte(commands.PICC_AUTHENT1B)
+Commands:
+  info                          chip version and card UID
+  read <block>                  read the block, 0..63
+  write <block> <hex>           write 16 bytes to the block
+  dump                          read every block
+  restore <file>                write the data blocks of a dump back to the card
+  trailer <sector>              show the keys and the access bits of the sector
+  trailer <sector> <keyA> <keyB> <b0,b1,b2,b3>
+                                write the sector trailer
+  value <block> [get]           read the value block
+  value <block> set|inc|dec <n> set, increment or decrement the value block
+  value <block> copy <to>       copy the value block to another block of the sector
+  ndef                          print the NDEF records
+  watch                         print every card entering the field
+  selftest                      run the chip self test
+  registers                     dump the chip registers
+  provision <template> [count]  provision count cards (default 1, 0 for no limit) from the JSON template
+  wedge [hex|decimal] [reverse] [noenter]
+                                type the UID of every card on a virtual keyboard
 
-	sector := flag.Int("s", 1, "card sector")
-	block := flag.Int("b", 0, "card block")
-	overwriteKey := flag.Bool("wa", false, "Overwrite keys")
-	overwriteBlock := flag.Bool("wb", false, "Overwrite block with 0-15")
+Exit codes: 1 failure, 2 usage, 3 reader, 4 no card, 5 authentication, 6 card, 7 self test.
 
+Flags:
+`
+
+// cliError carries the exit code for errors that are not reported by the library
+type cliError struct {
+	code int
+	err  error
+}
+
+func (e *cliError) Error() string {
+	return e.err.Error()
+}
+
+func usageError(format string, args ...interface{}) error {
+	return &cliError{code: exitUsage, err: errors.New(fmt.Sprintf(format, args...))}
+}
+
+var errNoCard = errors.New("no card")
+
+func exitCode(err error) int {
+	switch e := err.(type) {
+	case nil:
+		return exitOK
+	case *cliError:
+		return e.code
+	case *rf522.AuthError:
+		return exitAuth
+	}
+	if err == errNoCard {
+		return exitNoCard
+	}
+	return exitCard
+}
+
+// hexBytes is printed as a hex string in JSON
+type hexBytes []byte
+
+func (h hexBytes) MarshalText() ([]byte, error) {
+	return []byte(strings.ToUpper(hex.EncodeToString(h))), nil
+}
+
+func (h *hexBytes) UnmarshalText(text []byte) (err error) {
+	*h, err = parseHex(string(text))
+	return
+}
+
+func parseHex(s string) (data []byte, err error) {
+	data, err = hex.DecodeString(strings.Replace(s, ":", "", -1))
+	return
+}
+
+func parseKey(s string) (key []byte, err error) {
+	key, err = parseHex(s)
+	if err == nil && len(key) != 6 {
+		err = errors.New(fmt.Sprintf("key must be 6 bytes, got %d", len(key)))
+	}
+	return
+}
+
+type cli struct {
+	rfid    *rf522.RFID
+	auth    byte
+	key     []byte
+	json    bool
+	timeout time.Duration
+}
+
+// emit prints v as JSON or the text as is
+func (c *cli) emit(v interface{}, text string) (err error) {
+	if c.json {
+		err = json.NewEncoder(os.Stdout).Encode(v)
+	} else {
+		_, err = fmt.Print(text)
+	}
+	return
+}
+
+// card runs f, which waits for the card, giving up after the timeout
+func (c *cli) card(f func() error) (err error) {
+	if c.timeout == 0 {
+		return f()
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- f()
+	}()
+	select {
+	case err = <-done:
+	case <-time.After(c.timeout):
+		err = errNoCard
+	}
+	return
+}
+
+type options struct {
+	bus, device, speed int
+	resetPin, irqPin   int
+	keyType, key       string
+	format             string
+	timeout            time.Duration
+	trace              string
+	debug              bool
+}
+
+func main() {
+
+	var o options
+	flag.IntVar(&o.bus, "bus", 0, "SPI bus")
+	flag.IntVar(&o.device, "device", 0, "SPI device (chip select)")
+	flag.IntVar(&o.speed, "speed", 1000000, "SPI speed, Hz")
+	flag.IntVar(&o.resetPin, "reset", 27, "reader reset pin")
+	flag.IntVar(&o.irqPin, "irq", 17, "reader IRQ pin")
+	flag.StringVar(&o.keyType, "keytype", "A", "key type, A or B")
+	flag.StringVar(&o.key, "key", "FFFFFFFFFFFF", "key in hex")
+	flag.StringVar(&o.format, "format", "hex", "output format, hex or json")
+	flag.DurationVar(&o.timeout, "timeout", 10*time.Second, "how long to wait for the card, 0 to wait forever")
+	flag.StringVar(&o.trace, "trace", "", "append the register accesses to the file")
+	flag.BoolVar(&o.debug, "debug", false, "debug logging")
+
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
-	// use BCM numbering here
-	logrus.SetLevel(logrus.DebugLevel)
-	log.SetOutput(os.Stdout)
-	rfid, err := rf522.MakeRFID(0, 0, 1000000, 27, 17)
+	err := run(&o)
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, err)
+		code := exitCode(err)
+		if code == exitUsage {
+			flag.Usage()
+		}
+		os.Exit(code)
 	}
+}
+
+func run(o *options) (err error) {
 
-	data, err := rfid.ReadCard(currentAccessMethod, *sector, *block, currentAccessKey[:])
-	auth, err := rfid.ReadAuth(currentAccessMethod, *sector, currentAccessKey[:])
+	logrus.SetLevel(logrus.WarnLevel)
+	if o.debug {
+		logrus.SetLevel(logrus.DebugLevel)
+	}
+
+	args := flag.Args()
+	if len(args) == 0 {
+		return usageError("command expected")
+	}
+	command, ok := handlers[args[0]]
+	if !ok {
+		return usageError("unknown command %s", args[0])
+	}
 
-	access := rf522.ParseBlockAccess(auth[6:10])
+	c := &cli{timeout: o.timeout}
+	switch strings.ToUpper(o.keyType) {
+	case "A":
+		c.auth = commands.PICC_AUTHENT1A
+	case "B":
+		c.auth = commands.PICC_AUTHENT1B
+	default:
+		return usageError("unknown key type %s", o.keyType)
+	}
+	if c.key, err = parseKey(o.key); err != nil {
+		return usageError("bad key: %v", err)
+	}
+	switch o.format {
+	case "hex":
+	case "json":
+		c.json = true
+	default:
+		return usageError("unknown format %s", o.format)
+	}
 
+	// use BCM numbering here
+	c.rfid, err = rf522.MakeRFID(o.bus, o.device, o.speed, o.resetPin, o.irqPin)
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	fmt.Printf("RFID sector %d, block %d : %v, auth: %v\n", *sector, *block, data, auth)
-	fmt.Printf("Permissions: B0: %s, B1: %s, B2: %s, B3/A: %s\n",
-		strconv.FormatUint(uint64(access.B0), 2),
-		strconv.FormatUint(uint64(access.B1), 2),
-		strconv.FormatUint(uint64(access.B2), 2),
-		strconv.FormatUint(uint64(access.B3), 2),
-	)
-
-	if *overwriteBlock {
-		err = rfid.WriteBlock(currentAccessMethod,
-			*sector,
-			*block,
-			[16]byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
-			currentAccessKey[:])
-		if err != nil {
-			log.Fatal(err)
-		}
+		return &cliError{code: exitDevice, err: err}
 	}
+	defer c.rfid.Close()
 
-	if *overwriteKey {
-		err = rfid.WriteSectorTrail(commands.PICC_AUTHENT1A,
-			*sector,
-			[6]byte{1, 2, 3, 4, 5, 6},
-			[6]byte{6, 5, 4, 3, 2, 1},
-			&rf522.BlocksAccess{
-				B0: rf522.RAB_WB_IB_DAB,
-				B1: rf522.RB_WB_IN_DN,
-				B2: rf522.AnyKeyRWID,
-				B3: rf522.KeyA_RN_WN_BITS_RAB_WN_KeyB_RN_WN,
-			},
-			currentAccessKey[:],
-		)
+	if o.trace != "" {
+		tw, err := rf522.OpenTraceFile(o.trace)
 		if err != nil {
-			log.Fatal(err)
+			return &cliError{code: exitFailure, err: err}
 		}
-		fmt.Println("Write successful")
+		defer tw.Close()
+		c.rfid.SetTracer(tw.Trace)
 	}
 
+	err = command(c, args[1:])
+	return
 }
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDump(t *testing.T) {
+	hexDump := "04 000102030405060708090A0B0C0D0E0F\n\n05 FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF\n"
+	jsonDump := `[{"block":4,"data":"000102030405060708090A0B0C0D0E0F"},{"block":5,"data":"FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"}]`
+	for _, dump := range []string{hexDump, jsonDump} {
+		blocks, err := parseDump([]byte(dump))
+		assert.NoError(t, err)
+		if assert.Len(t, blocks, 2) {
+			assert.Equal(t, 4, blocks[0].Block)
+			assert.Equal(t, hexBytes{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, blocks[0].Data)
+			assert.Equal(t, 5, blocks[1].Block)
+		}
+	}
+	_, err := parseDump([]byte("64 00"))
+	assert.Error(t, err)
+	_, err = parseDump([]byte("1 00 00"))
+	assert.Error(t, err)
+}
+
+func TestParseKeyAndAccess(t *testing.T) {
+	key, err := parseKey("a0:a1:a2:a3:a4:a5")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xA0, 0xA1, 0xA2, 0xA3, 0xA4, 0xA5}, key)
+	_, err = parseKey("A0A1A2")
+	assert.Error(t, err)
+
+	access, err := parseAccess("0,0,0,1")
+	assert.NoError(t, err)
+	assert.Equal(t, rf522.SectorTrailerAccess(1), access.B3)
+	_, err = parseAccess("0,0,8,1")
+	assert.Error(t, err)
+}
+
+func TestExitCode(t *testing.T) {
+	assert.Equal(t, exitOK, exitCode(nil))
+	assert.Equal(t, exitUsage, exitCode(usageError("bad")))
+	assert.Equal(t, exitAuth, exitCode(&rf522.AuthError{Sector: 1}))
+	assert.Equal(t, exitNoCard, exitCode(errNoCard))
+	assert.Equal(t, exitCard, exitCode(errors.New("card")))
+}
+
+func TestKeyboardWedgeOptions(t *testing.T) {
+	// rejected before the virtual keyboard is created, no device needed
+	err := keyboardWedge(&cli{}, []string{"hex", "upper"})
+	assert.Equal(t, exitUsage, exitCode(err))
+}
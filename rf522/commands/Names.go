@@ -0,0 +1,44 @@
+package commands
+
+import "fmt"
+
+var registerNames = [64]string{
+	"Reserved00", "CommandReg", "CommIEnReg", "DivIEnReg", "CommIrqReg", "DivIrqReg", "ErrorReg", "Status1Reg",
+	"Status2Reg", "FIFODataReg", "FIFOLevelReg", "WaterLevelReg", "ControlReg", "BitFramingReg", "CollReg", "Reserved01",
+	"Reserved10", "ModeReg", "TxModeReg", "RxModeReg", "TxControlReg", "TxAutoReg", "TxSelReg", "RxSelReg",
+	"RxThresholdReg", "DemodReg", "Reserved11", "Reserved12", "MifareReg", "MfRxReg", "Reserved14", "SerialSpeedReg",
+	"Reserved20", "CRCResultRegM", "CRCResultRegL", "Reserved21", "ModWidthReg", "Reserved22", "RFCfgReg", "GsNReg",
+	"CWGsPReg", "ModGsPReg", "TModeReg", "TPrescalerReg", "TReloadRegH", "TReloadRegL", "TCounterValueRegH", "TCounterValueRegL",
+	"Reserved30", "TestSel1Reg", "TestSel2Reg", "TestPinEnReg", "TestPinValueReg", "TestBusReg", "AutoTestReg", "VersionReg",
+	"AnalogTestReg", "TestDAC1Reg", "TestDAC2Reg", "TestADCReg", "Reserved31", "Reserved32", "Reserved33", "Reserved34",
+}
+
+var commandNames = map[byte]string{
+	PCD_IDLE:       "Idle",
+	PCD_MEM:        "Mem",
+	0x02:           "GenerateRandomID",
+	PCD_CALCCRC:    "CalcCRC",
+	PCD_TRANSMIT:   "Transmit",
+	0x07:           "NoCmdChange",
+	PCD_RECEIVE:    "Receive",
+	PCD_TRANSCEIVE: "Transceive",
+	PCD_AUTHENT:    "MFAuthent",
+	PCD_RESETPHASE: "SoftReset",
+}
+
+// RegisterName returns the datasheet name of the register
+func RegisterName(address byte) string {
+	if address > 0x3F {
+		return fmt.Sprintf("Reg%02X", address)
+	}
+	return registerNames[address]
+}
+
+// CommandName returns the name of the command stored in bits 3..0 of
+// CommandReg
+func CommandName(command byte) string {
+	if name, ok := commandNames[command&0x0F]; ok {
+		return name
+	}
+	return fmt.Sprintf("Cmd%X", command&0x0F)
+}
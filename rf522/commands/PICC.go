@@ -2,6 +2,7 @@ package commands
 
 const (
 	PCD_IDLE       = 0x00
+	PCD_MEM        = 0x01
 	PCD_AUTHENT    = 0x0E
 	PCD_RECEIVE    = 0x08
 	PCD_TRANSMIT   = 0x04
@@ -22,4 +23,11 @@ const (
 	PICC_RESTORE   = 0xC2
 	PICC_TRANSFER  = 0xB0
 	PICC_HALT      = 0x50
+
+	PICC_ANTICOLL_CL2 = 0x95
+	PICC_ANTICOLL_CL3 = 0x97
+	PICC_UL_WRITE     = 0xA2
+	PICC_UL_AUTH      = 0x1A
+	PICC_UL_AUTH_CONT = 0xAF
+	PICC_UL_READ_SIG  = 0x3C
 )
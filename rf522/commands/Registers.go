@@ -31,7 +31,9 @@ const (
 	Reserved11     = 0x1A
 	Reserved12     = 0x1B
 	MifareReg      = 0x1C
-	Reserved13     = 0x1D
+	MfRxReg        = 0x1D
+	// Deprecated: use MfRxReg
+	Reserved13     = MfRxReg
 	Reserved14     = 0x1E
 	SerialSpeedReg = 0x1F
 
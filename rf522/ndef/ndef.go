@@ -0,0 +1,311 @@
+package ndef
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522"
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+)
+
+// TLV block types used in the data area of NFC Forum tags
+const (
+	TLVNull          = 0x00
+	TLVLockControl   = 0x01
+	TLVMemoryControl = 0x02
+	TLVMessage       = 0x03
+	TLVProprietary   = 0xFD
+	TLVTerminator    = 0xFE
+)
+
+// Type name formats
+const (
+	TNFEmpty     = 0x00
+	TNFWellKnown = 0x01
+	TNFMedia     = 0x02
+	TNFAbsURI    = 0x03
+	TNFExternal  = 0x04
+	TNFUnknown   = 0x05
+	TNFUnchanged = 0x06
+)
+
+const (
+	flagMB = 0x80
+	flagME = 0x40
+	flagCF = 0x20
+	flagSR = 0x10
+	flagIL = 0x08
+)
+
+// Keys A of the MIFARE Application Directory and of the NDEF sectors
+var (
+	MADKey = []byte{0xA0, 0xA1, 0xA2, 0xA3, 0xA4, 0xA5}
+	NFCKey = []byte{0xD3, 0xF7, 0xD3, 0xF7, 0xD3, 0xF7}
+)
+
+// ParseTLV returns the values of all the NDEF message TLVs found before the
+// terminator
+func ParseTLV(data []byte) (messages [][]byte, err error) {
+	for i := 0; i < len(data); {
+		t := data[i]
+		i++
+		switch t {
+		case TLVNull:
+			continue
+		case TLVTerminator:
+			return
+		}
+		if i >= len(data) {
+			err = errors.New(fmt.Sprintf("TLV 0x%02X: missing length", t))
+			return
+		}
+		length := int(data[i])
+		i++
+		if length == 0xFF {
+			if i+2 > len(data) {
+				err = errors.New(fmt.Sprintf("TLV 0x%02X: missing length", t))
+				return
+			}
+			length = int(data[i])<<8 | int(data[i+1])
+			i += 2
+		}
+		if i+length > len(data) {
+			err = errors.New(fmt.Sprintf("TLV 0x%02X: %d bytes expected, %d available", t, length, len(data)-i))
+			return
+		}
+		if t == TLVMessage {
+			messages = append(messages, data[i:i+length])
+		}
+		i += length
+	}
+	return
+}
+
+// Record is a single NDEF record
+type Record struct {
+	TNF     byte
+	Type    []byte
+	ID      []byte
+	Payload []byte
+}
+
+// ParseMessage splits the NDEF message into records. Chunked records are not
+// supported.
+func ParseMessage(data []byte) (records []Record, err error) {
+	for i := 0; i < len(data); {
+		header := data[i]
+		if i == 0 && header&flagMB == 0 {
+			err = errors.New("first record has no MB flag")
+			return
+		}
+		if header&flagCF != 0 {
+			err = errors.New("chunked records are not supported")
+			return
+		}
+		need := func(n int) bool {
+			if i+n > len(data) {
+				err = errors.New(fmt.Sprintf("record %d is truncated", len(records)))
+				return false
+			}
+			return true
+		}
+		headerLen := 3
+		if header&flagSR == 0 {
+			headerLen = 6
+		}
+		if header&flagIL != 0 {
+			headerLen++
+		}
+		if !need(headerLen) {
+			return
+		}
+		typeLen := int(data[i+1])
+		var payloadLen, idLen int
+		p := i + 2
+		if header&flagSR != 0 {
+			payloadLen = int(data[p])
+			p++
+		} else {
+			// checked before the conversion, int is 32 bit on the Pi
+			long := binary.BigEndian.Uint32(data[p:])
+			if uint64(long) > uint64(len(data)-p) {
+				err = errors.New(fmt.Sprintf("record %d is truncated", len(records)))
+				return
+			}
+			payloadLen = int(long)
+			p += 4
+		}
+		if header&flagIL != 0 {
+			idLen = int(data[p])
+			p++
+		}
+		i = p
+		if !need(typeLen + idLen + payloadLen) {
+			return
+		}
+		rec := Record{TNF: header & 0x07}
+		rec.Type = data[i : i+typeLen]
+		i += typeLen
+		rec.ID = data[i : i+idLen]
+		i += idLen
+		rec.Payload = data[i : i+payloadLen]
+		i += payloadLen
+		records = append(records, rec)
+		if header&flagME != 0 {
+			return
+		}
+	}
+	err = errors.New("last record has no ME flag")
+	return
+}
+
+func (r *Record) isWellKnown(t string) bool {
+	return r.TNF == TNFWellKnown && string(r.Type) == t
+}
+
+// Text decodes a well-known text record
+func (r *Record) Text() (lang, text string, err error) {
+	if !r.isWellKnown("T") || len(r.Payload) == 0 {
+		err = errors.New("not a text record")
+		return
+	}
+	status := r.Payload[0]
+	if status&0x80 != 0 {
+		err = errors.New("UTF-16 text is not supported")
+		return
+	}
+	n := int(status & 0x3F)
+	if 1+n > len(r.Payload) {
+		err = errors.New("text record is truncated")
+		return
+	}
+	lang = string(r.Payload[1 : 1+n])
+	text = string(r.Payload[1+n:])
+	if !utf8.ValidString(text) {
+		err = errors.New("text is not valid UTF-8")
+	}
+	return
+}
+
+var uriPrefixes = []string{
+	"", "http://www.", "https://www.", "http://", "https://", "tel:", "mailto:",
+	"ftp://anonymous:anonymous@", "ftp://ftp.", "ftps://", "sftp://", "smb://",
+	"nfs://", "ftp://", "dav://", "news:", "telnet://", "imap:", "rtsp://", "urn:",
+	"pop:", "sip:", "sips:", "tftp:", "btspp://", "btl2cap://", "btgoep://",
+	"tcpobex://", "irdaobex://", "file://", "urn:epc:id:", "urn:epc:tag:",
+	"urn:epc:pat:", "urn:epc:raw:", "urn:epc:", "urn:nfc:",
+}
+
+// URI decodes a well-known URI record
+func (r *Record) URI() (uri string, err error) {
+	if !r.isWellKnown("U") || len(r.Payload) == 0 {
+		err = errors.New("not a URI record")
+		return
+	}
+	prefix := ""
+	if int(r.Payload[0]) < len(uriPrefixes) {
+		prefix = uriPrefixes[r.Payload[0]]
+	}
+	uri = prefix + string(r.Payload[1:])
+	return
+}
+
+// String gives a human readable description of the record
+func (r *Record) String() string {
+	if lang, text, err := r.Text(); err == nil {
+		return fmt.Sprintf("text [%s] %s", lang, text)
+	}
+	if uri, err := r.URI(); err == nil {
+		return fmt.Sprintf("uri %s", uri)
+	}
+	return fmt.Sprintf("tnf %d type %q payload %x", r.TNF, r.Type, r.Payload)
+}
+
+// madCRC is the CRC-8 protecting the MIFARE Application Directory
+func madCRC(data []byte) (crc byte) {
+	crc = 0xC7
+	for _, b := range data {
+		crc ^= b
+		for i := 0; i < 8; i++ {
+			if crc&0x80 != 0 {
+				crc = crc<<1 ^ 0x1D
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return
+}
+
+// ParseMAD returns the sectors the MAD v1 (blocks 1 and 2 of sector 0)
+// assigns to the NDEF application (AID 0x03E1)
+func ParseMAD(data []byte) (sectors []int, err error) {
+	if len(data) != 32 {
+		err = errors.New(fmt.Sprintf("MAD must be 32 bytes, got %d", len(data)))
+		return
+	}
+	if crc := madCRC(data[1:]); crc != data[0] {
+		err = errors.New(fmt.Sprintf("MAD CRC mismatch: 0x%02X, expected 0x%02X", data[0], crc))
+		return
+	}
+	for s := 1; s < 16; s++ {
+		if data[2*s] == 0x03 && data[2*s+1] == 0xE1 {
+			sectors = append(sectors, s)
+		}
+	}
+	return
+}
+
+// ReadClassic reads the NDEF data area of a MIFARE Classic 1K card formatted
+// as an NFC Forum tag
+func ReadClassic(r *rf522.RFID) (data []byte, err error) {
+	mad, err := r.ReadBlocks(commands.PICC_AUTHENT1A, []int{1, 2}, MADKey)
+	if err != nil {
+		return
+	}
+	sectors, err := ParseMAD(append(mad[0], mad[1]...))
+	if err != nil {
+		return
+	}
+	if len(sectors) == 0 {
+		err = errors.New("no NDEF sectors")
+		return
+	}
+	var blocks []int
+	for _, s := range sectors {
+		for b := 0; b < rf522.BlocksPerSector-1; b++ {
+			blocks = append(blocks, s*rf522.BlocksPerSector+b)
+		}
+	}
+	content, err := r.ReadBlocks(commands.PICC_AUTHENT1A, blocks, NFCKey)
+	if err != nil {
+		return
+	}
+	for _, b := range content {
+		data = append(data, b...)
+	}
+	return
+}
+
+// ReadMessages reads the card and parses every NDEF message on it
+func ReadMessages(r *rf522.RFID) (records [][]Record, err error) {
+	data, err := ReadClassic(r)
+	if err != nil {
+		return
+	}
+	messages, err := ParseTLV(data)
+	if err != nil {
+		return
+	}
+	for _, m := range messages {
+		recs, err1 := ParseMessage(m)
+		if err1 != nil {
+			err = err1
+			return
+		}
+		records = append(records, recs)
+	}
+	return
+}
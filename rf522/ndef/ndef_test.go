@@ -0,0 +1,83 @@
+package ndef
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMAD(t *testing.T) {
+	// all the sectors assigned to NDEF, as formatted by NFC Forum tools
+	mad := []byte{0x14, 0x01}
+	for i := 0; i < 15; i++ {
+		mad = append(mad, 0x03, 0xE1)
+	}
+	sectors, err := ParseMAD(mad)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}, sectors)
+
+	mad[0] = 0x15
+	_, err = ParseMAD(mad)
+	assert.Error(t, err)
+}
+
+func TestParseMessages(t *testing.T) {
+	data := []byte{
+		0x00,       // NULL TLV
+		0x03, 0x1E, // NDEF message TLV
+		0x91, 0x01, 0x0C, 0x55, // URI record, MB
+		0x02, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm',
+		0x51, 0x01, 0x08, 0x54, // text record, ME
+		0x02, 'e', 'n', 'h', 'e', 'l', 'l', 'o',
+		0xFE, 0x00, 0x00,
+	}
+	messages, err := ParseTLV(data)
+	assert.NoError(t, err)
+	if !assert.Len(t, messages, 1) {
+		return
+	}
+	records, err := ParseMessage(messages[0])
+	assert.NoError(t, err)
+	if !assert.Len(t, records, 2) {
+		return
+	}
+	uri, err := records[0].URI()
+	assert.NoError(t, err)
+	assert.Equal(t, "https://www.example.com", uri)
+	lang, text, err := records[1].Text()
+	assert.NoError(t, err)
+	assert.Equal(t, "en", lang)
+	assert.Equal(t, "hello", text)
+	assert.Equal(t, "text [en] hello", records[1].String())
+
+	_, err = records[1].URI()
+	assert.Error(t, err)
+}
+
+func TestParseBroken(t *testing.T) {
+	_, err := ParseTLV([]byte{0x03, 0x10, 0xD1})
+	assert.Error(t, err)
+	_, err = ParseTLV([]byte{0x03, 0xFF, 0x01})
+	assert.Error(t, err)
+	_, err = ParseMessage([]byte{0xD1, 0x01, 0x08, 0x54, 0x02})
+	assert.Error(t, err)
+	_, err = ParseMessage([]byte{0x11, 0x01, 0x00, 0x54})
+	assert.Error(t, err, "no MB flag")
+	_, err = ParseMessage([]byte{0x91, 0x01, 0x00, 0x54})
+	assert.Error(t, err, "no ME flag")
+
+	// long record
+	records, err := ParseMessage([]byte{0xC2, 0x01, 0x00, 0x00, 0x00, 0x02, 'x', 0xAB, 0xCD})
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0xAB, 0xCD}, records[0].Payload)
+	assert.Equal(t, byte(TNFMedia), records[0].TNF)
+
+	// lengths that don't fit into a 32 bit int
+	for _, length := range [][]byte{{0x80, 0x00, 0x00, 0x00}, {0xFF, 0xFF, 0xFF, 0xFF}} {
+		msg := append(append([]byte{0xC2, 0x01}, length...), 'x', 0xAB, 0xCD)
+		assert.NotPanics(t, func() {
+			_, err = ParseMessage(msg)
+		})
+		assert.Error(t, err, "% X", length)
+	}
+}
@@ -0,0 +1,328 @@
+package provision
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522"
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/sirupsen/logrus"
+)
+
+// Key is a sector key, written as 12 hex digits in the template
+type Key [6]byte
+
+func (k Key) MarshalText() ([]byte, error) {
+	return []byte(strings.ToUpper(hex.EncodeToString(k[:]))), nil
+}
+
+func (k *Key) UnmarshalText(text []byte) (err error) {
+	err = unmarshalHex(text, k[:])
+	return
+}
+
+// Data is the content of a block, written as 32 hex digits in the template
+type Data [16]byte
+
+func (d Data) MarshalText() ([]byte, error) {
+	return []byte(strings.ToUpper(hex.EncodeToString(d[:]))), nil
+}
+
+func (d *Data) UnmarshalText(text []byte) (err error) {
+	err = unmarshalHex(text, d[:])
+	return
+}
+
+func unmarshalHex(text []byte, dst []byte) (err error) {
+	v, err := hex.DecodeString(strings.Replace(string(text), ":", "", -1))
+	if err != nil {
+		return
+	}
+	if len(v) != len(dst) {
+		err = errors.New(fmt.Sprintf("%d bytes expected, got %d", len(dst), len(v)))
+		return
+	}
+	copy(dst, v)
+	return
+}
+
+// Sector describes the content, the keys and the access bits of a sector
+type Sector struct {
+	Sector int          `json:"sector"`
+	KeyA   Key          `json:"keyA"`
+	KeyB   Key          `json:"keyB"`
+	Access [4]int       `json:"access"` // B0, B1, B2, B3 as in rf522.BlocksAccess
+	Auth   string       `json:"auth"`   // the key the provisioned sector is accessed with, A (default) or B
+	Blocks map[int]Data `json:"blocks"` // data blocks by number within the sector, 0..2
+}
+
+// Template is the layout of the provisioned cards. Sectors that are not
+// listed are left alone.
+type Template struct {
+	Name string `json:"name"`
+	// TransportKeys are the keys A the blank cards are delivered with,
+	// FFFFFFFFFFFF if empty
+	TransportKeys []Key    `json:"transportKeys"`
+	Sectors       []Sector `json:"sectors"`
+}
+
+// ParseTemplate reads and validates the JSON template
+func ParseTemplate(r io.Reader) (t *Template, err error) {
+	tmpl := new(Template)
+	decoder := json.NewDecoder(r)
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(tmpl); err != nil {
+		return
+	}
+	if err = tmpl.validate(); err != nil {
+		return
+	}
+	t = tmpl
+	return
+}
+
+func (t *Template) validate() (err error) {
+	seen := make(map[int]bool)
+	for _, s := range t.Sectors {
+		switch {
+		case s.Sector < 0 || s.Sector >= rf522.SectorCount:
+			err = errors.New(fmt.Sprintf("sector %d is out of range", s.Sector))
+		case seen[s.Sector]:
+			err = errors.New(fmt.Sprintf("sector %d is listed twice", s.Sector))
+		case s.Auth != "" && s.Auth != "A" && s.Auth != "B":
+			err = errors.New(fmt.Sprintf("sector %d: unknown key type %s", s.Sector, s.Auth))
+		}
+		if err != nil {
+			return
+		}
+		seen[s.Sector] = true
+		for _, a := range s.Access {
+			if a < 0 || a > 7 {
+				err = errors.New(fmt.Sprintf("sector %d: access bits %d out of range", s.Sector, a))
+				return
+			}
+		}
+		for b := range s.Blocks {
+			if b < 0 || b >= rf522.BlocksPerSector-1 || s.Sector == 0 && b == 0 {
+				err = errors.New(fmt.Sprintf("sector %d: block %d can't be provisioned", s.Sector, b))
+				return
+			}
+		}
+	}
+	return
+}
+
+func (t *Template) transportKeys() []Key {
+	if len(t.TransportKeys) == 0 {
+		return []Key{{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}}
+	}
+	return t.TransportKeys
+}
+
+func (s *Sector) access() *rf522.BlocksAccess {
+	return &rf522.BlocksAccess{
+		B0: rf522.BlockAccess(s.Access[0]),
+		B1: rf522.BlockAccess(s.Access[1]),
+		B2: rf522.BlockAccess(s.Access[2]),
+		B3: rf522.SectorTrailerAccess(s.Access[3]),
+	}
+}
+
+// key returns the key the provisioned sector is accessed with
+func (s *Sector) key() (auth byte, key []byte) {
+	if s.Auth == "B" {
+		return commands.PICC_AUTHENT1B, s.KeyB[:]
+	}
+	return commands.PICC_AUTHENT1A, s.KeyA[:]
+}
+
+// Card is the part of rf522.CardSession the provisioning needs, all the
+// operations go to the same card
+type Card interface {
+	UID() []byte
+	ReadBlocks(auth byte, blocks []int, key []byte) ([][]byte, error)
+	WriteBlocks(auth byte, blocks []rf522.BlockData, key []byte) error
+	WriteSectorTrail(auth byte, sector int, keyA [6]byte, keyB [6]byte, access *rf522.BlocksAccess, key []byte) error
+}
+
+// SectorResult tells what was done to a sector
+type SectorResult struct {
+	Sector         int    `json:"sector"`
+	Written        []int  `json:"written,omitempty"` // data blocks written, by number within the sector
+	TrailerWritten bool   `json:"trailerWritten,omitempty"`
+	Error          string `json:"error,omitempty"`
+}
+
+// Result is the outcome for a single card
+type Result struct {
+	UID     string         `json:"uid"`
+	OK      bool           `json:"ok"`
+	Sectors []SectorResult `json:"sectors"`
+	Error   string         `json:"error,omitempty"`
+}
+
+func sectorBlocks(sector int) []int {
+	blocks := make([]int, rf522.BlocksPerSector)
+	for i := range blocks {
+		blocks[i] = sector*rf522.BlocksPerSector + i
+	}
+	return blocks
+}
+
+// readSector finds the key the sector is currently accessible with: the
+// template key if the card was provisioned before, a transport key otherwise
+func (t *Template) readSector(c Card, s *Sector) (auth byte, key []byte, data [][]byte, provisioned bool, err error) {
+	auth, key = s.key()
+	data, err = c.ReadBlocks(auth, sectorBlocks(s.Sector), key)
+	if err == nil {
+		provisioned = true
+		return
+	}
+	for _, k := range t.transportKeys() {
+		if _, ok := err.(*rf522.AuthError); !ok {
+			return
+		}
+		auth, key = commands.PICC_AUTHENT1A, append([]byte{}, k[:]...)
+		data, err = c.ReadBlocks(auth, sectorBlocks(s.Sector), key)
+		if err == nil {
+			break
+		}
+	}
+	return
+}
+
+func (t *Template) applySector(c Card, s *Sector) (res SectorResult, err error) {
+	res.Sector = s.Sector
+	auth, key, data, provisioned, err := t.readSector(c, s)
+	if err != nil {
+		return
+	}
+	var blocks []rf522.BlockData
+	for b := 0; b < rf522.BlocksPerSector-1; b++ {
+		want, ok := s.Blocks[b]
+		if !ok || bytes.Equal(want[:], data[b]) {
+			continue
+		}
+		blocks = append(blocks, rf522.BlockData{Address: s.Sector*rf522.BlocksPerSector + b, Data: want})
+		res.Written = append(res.Written, b)
+	}
+	if len(blocks) > 0 {
+		if err = c.WriteBlocks(auth, blocks, key); err != nil {
+			return
+		}
+	}
+	// the keys can't be read back, a sector is considered provisioned when
+	// the template key works
+	if !provisioned || *rf522.ParseBlockAccess(data[3][6:10]) != *s.access() {
+		err = c.WriteSectorTrail(auth, s.Sector, s.KeyA, s.KeyB, s.access(), key)
+		if err != nil {
+			return
+		}
+		res.TrailerWritten = true
+	}
+	return
+}
+
+func (t *Template) verifySector(c Card, s *Sector) (err error) {
+	auth, key := s.key()
+	data, err := c.ReadBlocks(auth, sectorBlocks(s.Sector), key)
+	if err != nil {
+		return
+	}
+	for b, want := range s.Blocks {
+		if !bytes.Equal(want[:], data[b]) {
+			err = errors.New(fmt.Sprintf("block %d: %X, expected %X", b, data[b], want))
+			return
+		}
+	}
+	if *rf522.ParseBlockAccess(data[3][6:10]) != *s.access() {
+		err = errors.New(fmt.Sprintf("access bits %X", data[3][6:10]))
+	}
+	return
+}
+
+// Apply brings the card in the field to the template. Blocks and trailers
+// that already match are not written, so a card can be provisioned again
+// safely. Every sector is read back with the template key afterwards.
+func (t *Template) Apply(c Card) (res *Result) {
+	res = &Result{UID: strings.ToUpper(hex.EncodeToString(c.UID())), OK: true}
+	for i := range t.Sectors {
+		s := &t.Sectors[i]
+		sr, err := t.applySector(c, s)
+		if err == nil {
+			err = t.verifySector(c, s)
+		}
+		if err != nil {
+			logrus.Warn("Sector ", s.Sector, ": ", err)
+			sr.Error = err.Error()
+			res.OK = false
+		}
+		res.Sectors = append(res.Sectors, sr)
+	}
+	if !res.OK {
+		res.Error = "some sectors failed"
+	}
+	return
+}
+
+// Reader is the reader a batch run needs, WithCard runs f on the card in
+// the field, see rf522.RFID.WithCard
+type Reader interface {
+	rf522.CardReader
+	WithCard(f func(c Card) error) error
+}
+
+type rfidReader struct {
+	*rf522.RFID
+}
+
+func (r rfidReader) WithCard(f func(c Card) error) error {
+	return r.RFID.WithCard(func(c *rf522.CardSession) error {
+		return f(c)
+	})
+}
+
+// NewReader returns the batch reader for the RFID reader
+func NewReader(r *rf522.RFID) Reader {
+	return rfidReader{r}
+}
+
+// batchHoldOff is the time a card has to be out of the field to be
+// provisioned again
+const batchHoldOff = time.Second
+
+var errBatchDone = errors.New("batch done")
+
+// Batch provisions count cards, 0 means until the reader fails. Each card is
+// reported once, the same card has to leave the field to be provisioned again.
+// The card is selected once for all its sectors, a card that replaces it in
+// the field is not written to.
+func (t *Template) Batch(r Reader, count int, report func(res *Result)) (err error) {
+	n := 0
+	err = rf522.Cards(r, batchHoldOff, func(uid []byte) error {
+		var res *Result
+		err := r.WithCard(func(c Card) error {
+			res = t.Apply(c)
+			return nil
+		})
+		if err != nil {
+			logrus.Warn("Card ", hex.EncodeToString(uid), ": ", err)
+			res = &Result{UID: strings.ToUpper(hex.EncodeToString(uid)), Error: err.Error()}
+		}
+		report(res)
+		if n++; count != 0 && n >= count {
+			return errBatchDone
+		}
+		return nil
+	})
+	if err == errBatchDone {
+		err = nil
+	}
+	return
+}
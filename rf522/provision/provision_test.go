@@ -0,0 +1,222 @@
+package provision
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522"
+	"github.com/jdevelop/golang-rpi-extras/rf522/commands"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeCard is a MIFARE Classic 1K that checks the keys but not the access
+// bits
+type fakeCard struct {
+	blocks [rf522.SectorCount * rf522.BlocksPerSector][16]byte
+	writes int
+	reads  int
+	uid    []byte
+	uids   [][]byte
+}
+
+func newFakeCard() (c *fakeCard) {
+	c = new(fakeCard)
+	for s := 0; s < rf522.SectorCount; s++ {
+		trailer := &c.blocks[s*rf522.BlocksPerSector+3]
+		copy(trailer[:], []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0x07, 0x80, 0x69, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	}
+	return
+}
+
+func (c *fakeCard) auth(mode byte, sector int, key []byte) (err error) {
+	trailer := c.blocks[sector*rf522.BlocksPerSector+3]
+	expected := trailer[0:6]
+	if mode == commands.PICC_AUTHENT1B {
+		expected = trailer[10:16]
+	}
+	if !bytes.Equal(expected, key) {
+		err = &rf522.AuthError{Sector: sector, Status: rf522.AuthFailure}
+	}
+	return
+}
+
+func (c *fakeCard) ReadBlocks(auth byte, blocks []int, key []byte) (data [][]byte, err error) {
+	c.reads++
+	for _, b := range blocks {
+		if err = c.auth(auth, b/rf522.BlocksPerSector, key); err != nil {
+			return
+		}
+		block := append([]byte{}, c.blocks[b][:]...)
+		if b%rf522.BlocksPerSector == 3 {
+			// key A is never readable
+			copy(block[0:6], make([]byte, 6))
+		}
+		data = append(data, block)
+	}
+	return
+}
+
+func (c *fakeCard) WriteBlocks(auth byte, blocks []rf522.BlockData, key []byte) (err error) {
+	for _, b := range blocks {
+		if err = c.auth(auth, b.Address/rf522.BlocksPerSector, key); err != nil {
+			return
+		}
+		c.blocks[b.Address] = b.Data
+		c.writes++
+	}
+	return
+}
+
+func (c *fakeCard) WriteSectorTrail(auth byte, sector int, keyA [6]byte, keyB [6]byte, access *rf522.BlocksAccess, key []byte) (err error) {
+	if err = c.auth(auth, sector, key); err != nil {
+		return
+	}
+	trailer := &c.blocks[sector*rf522.BlocksPerSector+3]
+	copy(trailer[0:6], keyA[:])
+	copy(trailer[6:10], rf522.CalculateBlockAccess(access))
+	copy(trailer[10:16], keyB[:])
+	c.writes++
+	return
+}
+
+func (c *fakeCard) UID() []byte {
+	return c.uid
+}
+
+func (c *fakeCard) Wait() error {
+	if len(c.uids) == 0 {
+		return errors.New("stop signal")
+	}
+	return nil
+}
+
+// ReadUID takes the next card from the queue, nil stands for an empty field
+func (c *fakeCard) ReadUID() (uid []byte, err error) {
+	uid, c.uids = c.uids[0], c.uids[1:]
+	if uid == nil {
+		err = errors.New("no card")
+	}
+	c.uid = uid
+	return
+}
+
+func (c *fakeCard) WithCard(f func(c Card) error) error {
+	return f(c)
+}
+
+const template = `{
+  "name": "transit",
+  "sectors": [
+    {
+      "sector": 1,
+      "keyA": "A0A1A2A3A4A5",
+      "keyB": "B0B1B2B3B4B5",
+      "access": [0, 0, 4, 3],
+      "blocks": {
+        "0": "000102030405060708090A0B0C0D0E0F",
+        "2": "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF"
+      }
+    },
+    {
+      "sector": 2,
+      "keyA": "A0A1A2A3A4A5",
+      "keyB": "B0B1B2B3B4B5",
+      "access": [6, 6, 6, 3],
+      "auth": "B"
+    }
+  ]
+}`
+
+func TestParseTemplate(t *testing.T) {
+	tmpl, err := ParseTemplate(strings.NewReader(template))
+	assert.NoError(t, err)
+	assert.Equal(t, "transit", tmpl.Name)
+	assert.Equal(t, 2, len(tmpl.Sectors))
+	assert.Equal(t, Key{0xA0, 0xA1, 0xA2, 0xA3, 0xA4, 0xA5}, tmpl.Sectors[0].KeyA)
+	assert.Equal(t, byte(0x0F), tmpl.Sectors[0].Blocks[0][15])
+
+	for _, bad := range []string{
+		`{"sectors": [{"sector": 16}]}`,
+		`{"sectors": [{"sector": 1}, {"sector": 1}]}`,
+		`{"sectors": [{"sector": 0, "blocks": {"0": "00000000000000000000000000000000"}}]}`,
+		`{"sectors": [{"sector": 1, "blocks": {"3": "00000000000000000000000000000000"}}]}`,
+		`{"sectors": [{"sector": 1, "access": [8, 0, 0, 0]}]}`,
+		`{"sectors": [{"sector": 1, "auth": "C"}]}`,
+		`{"sectors": [{"sector": 1, "keyA": "A0A1"}]}`,
+		`{"sectors": [{"sector": 1, "unknown": true}]}`,
+	} {
+		_, err = ParseTemplate(strings.NewReader(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestApplyIsIdempotent(t *testing.T) {
+	tmpl, err := ParseTemplate(strings.NewReader(template))
+	assert.NoError(t, err)
+	card := newFakeCard()
+	// block 2 of sector 1 already has the right content
+	for i := range card.blocks[6] {
+		card.blocks[6][i] = 0xFF
+	}
+
+	card.uid = []byte{1, 2, 3, 4}
+	res := tmpl.Apply(card)
+	assert.True(t, res.OK, res.Error)
+	assert.Equal(t, "01020304", res.UID)
+	assert.Equal(t, []SectorResult{
+		{Sector: 1, Written: []int{0}, TrailerWritten: true},
+		{Sector: 2, TrailerWritten: true},
+	}, res.Sectors)
+	assert.Equal(t, 3, card.writes)
+	assert.Equal(t, byte(0x0F), card.blocks[4][15])
+
+	res = tmpl.Apply(card)
+	assert.True(t, res.OK, res.Error)
+	assert.Equal(t, []SectorResult{{Sector: 1}, {Sector: 2}}, res.Sectors)
+	assert.Equal(t, 3, card.writes, "nothing to write the second time")
+}
+
+func TestApplyUnknownKey(t *testing.T) {
+	tmpl, err := ParseTemplate(strings.NewReader(template))
+	assert.NoError(t, err)
+	card := newFakeCard()
+	copy(card.blocks[11][0:6], []byte{1, 2, 3, 4, 5, 6})
+
+	res := tmpl.Apply(card)
+	assert.False(t, res.OK)
+	assert.Equal(t, "", res.Sectors[0].Error)
+	assert.NotEqual(t, "", res.Sectors[1].Error)
+}
+
+func TestApplyTransportKeys(t *testing.T) {
+	tmpl, err := ParseTemplate(strings.NewReader(template))
+	assert.NoError(t, err)
+	tmpl.Sectors = tmpl.Sectors[:1]
+	tmpl.TransportKeys = []Key{{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, {0xD3, 0xF7, 0xD3, 0xF7, 0xD3, 0xF7}}
+	card := newFakeCard()
+
+	auth, key, _, provisioned, err := tmpl.readSector(card, &tmpl.Sectors[0])
+	assert.NoError(t, err)
+	assert.False(t, provisioned)
+	assert.Equal(t, byte(commands.PICC_AUTHENT1A), auth)
+	assert.Equal(t, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, key)
+	assert.Equal(t, 2, card.reads, "the template key and the first transport key")
+}
+
+func TestBatch(t *testing.T) {
+	tmpl, err := ParseTemplate(strings.NewReader(template))
+	assert.NoError(t, err)
+	card := newFakeCard()
+	card.uids = [][]byte{{1, 1, 1, 1}, {1, 1, 1, 1}, nil, {2, 2, 2, 2}, {3, 3, 3, 3}}
+
+	var uids []string
+	err = tmpl.Batch(card, 2, func(res *Result) {
+		assert.True(t, res.OK)
+		uids = append(uids, res.UID)
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"01010101", "02020202"}, uids)
+	assert.Equal(t, 1, len(card.uids))
+}
@@ -0,0 +1,315 @@
+// Package spi_replay records the SPI traffic of a driver into a text file and
+// replays it through a fake bus, so a session captured on the hardware can be
+// turned into a test.
+//
+// A session file has one operation per line, bytes in hex:
+//
+//	# comment
+//	transfer <sent> <received>
+//	write <sent>
+//	read <received>
+//	pin <name> <0|1>
+package spi_replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jdevelop/gpio"
+)
+
+// Conn is the part of *spi.Device the drivers use
+type Conn interface {
+	Transfer(buf []byte) error
+	Write(buf []byte) error
+	Read(buf []byte) error
+	Close() error
+}
+
+// Op is a single bus operation
+type Op struct {
+	Kind  string // transfer, write, read or pin
+	Pin   string
+	Level bool
+	Tx    []byte
+	Rx    []byte
+}
+
+func (o Op) String() string {
+	switch o.Kind {
+	case "transfer":
+		return fmt.Sprintf("transfer %X %X", o.Tx, o.Rx)
+	case "write":
+		return fmt.Sprintf("write %X", o.Tx)
+	case "read":
+		return fmt.Sprintf("read %X", o.Rx)
+	case "pin":
+		level := 0
+		if o.Level {
+			level = 1
+		}
+		return fmt.Sprintf("pin %s %d", o.Pin, level)
+	}
+	return o.Kind
+}
+
+// ParseSession reads the session file
+func ParseSession(r io.Reader) (ops []Op, err error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		op := Op{Kind: fields[0]}
+		bad := func() {
+			err = errors.New(fmt.Sprintf("line %d: bad operation %q", line, text))
+		}
+		switch {
+		case op.Kind == "transfer" && len(fields) == 3:
+			op.Tx, err = hex.DecodeString(fields[1])
+			if err == nil {
+				op.Rx, err = hex.DecodeString(fields[2])
+			}
+			if err == nil && len(op.Tx) != len(op.Rx) {
+				bad()
+			}
+		case op.Kind == "write" && len(fields) == 2:
+			op.Tx, err = hex.DecodeString(fields[1])
+		case op.Kind == "read" && len(fields) == 2:
+			op.Rx, err = hex.DecodeString(fields[1])
+		case op.Kind == "pin" && len(fields) == 3 && (fields[2] == "0" || fields[2] == "1"):
+			op.Pin = fields[1]
+			op.Level = fields[2] == "1"
+		default:
+			bad()
+		}
+		if err != nil {
+			return
+		}
+		ops = append(ops, op)
+	}
+	err = scanner.Err()
+	return
+}
+
+// Recorder passes every operation to the real bus and writes it to the session
+type Recorder struct {
+	conn Conn
+	w    io.Writer
+	mu   sync.Mutex
+}
+
+func NewRecorder(conn Conn, w io.Writer) *Recorder {
+	return &Recorder{conn: conn, w: w}
+}
+
+func (r *Recorder) record(op Op) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintln(r.w, op.String())
+}
+
+// Comment adds a comment line to the session, e.g. to describe the scenario
+func (r *Recorder) Comment(text string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintln(r.w, "# "+line)
+	}
+}
+
+func (r *Recorder) Transfer(buf []byte) (err error) {
+	tx := append([]byte{}, buf...)
+	err = r.conn.Transfer(buf)
+	if err == nil {
+		r.record(Op{Kind: "transfer", Tx: tx, Rx: append([]byte{}, buf...)})
+	}
+	return
+}
+
+func (r *Recorder) Write(buf []byte) (err error) {
+	err = r.conn.Write(buf)
+	if err == nil {
+		r.record(Op{Kind: "write", Tx: append([]byte{}, buf...)})
+	}
+	return
+}
+
+func (r *Recorder) Read(buf []byte) (err error) {
+	err = r.conn.Read(buf)
+	if err == nil {
+		r.record(Op{Kind: "read", Rx: append([]byte{}, buf...)})
+	}
+	return
+}
+
+// Close closes the real bus, the session writer is left open
+func (r *Recorder) Close() error {
+	return r.conn.Close()
+}
+
+// recordedPin records the level changes of an output pin
+type recordedPin struct {
+	gpio.Pin
+	name string
+	r    *Recorder
+}
+
+func (p *recordedPin) Set() {
+	p.Pin.Set()
+	p.r.record(Op{Kind: "pin", Pin: p.name, Level: true})
+}
+
+func (p *recordedPin) Clear() {
+	p.Pin.Clear()
+	p.r.record(Op{Kind: "pin", Pin: p.name, Level: false})
+}
+
+// Pin wraps an output pin whose level changes are part of the session, like
+// the data/command pin of a display
+func (r *Recorder) Pin(name string, pin gpio.Pin) gpio.Pin {
+	return &recordedPin{Pin: pin, name: name, r: r}
+}
+
+// Divergence is reported when the driver doesn't repeat the recorded session
+type Divergence struct {
+	Index    int // number of the operation in the session
+	Expected string
+	Actual   string
+}
+
+func (d *Divergence) Error() string {
+	return fmt.Sprintf("operation %d: expected %q, got %q", d.Index, d.Expected, d.Actual)
+}
+
+// Replayer is a fake bus answering with the recorded data. The first
+// divergence from the session is sticky: every later operation fails with it.
+type Replayer struct {
+	ops []Op
+	pos int
+	err error
+	mu  sync.Mutex
+}
+
+func NewReplayer(ops []Op) *Replayer {
+	return &Replayer{ops: ops}
+}
+
+// LoadReplayer reads the session from the file
+func LoadReplayer(path string) (r *Replayer, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	ops, err := ParseSession(f)
+	if err != nil {
+		return
+	}
+	r = NewReplayer(ops)
+	return
+}
+
+// next matches the operation against the session and returns the recorded one
+func (r *Replayer) next(actual Op) (op Op, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		err = r.err
+		return
+	}
+	expected := "end of session"
+	if r.pos < len(r.ops) {
+		op = r.ops[r.pos]
+		expected = op.String()
+		if op.Kind == actual.Kind && op.Pin == actual.Pin && op.Level == actual.Level &&
+			bytes.Equal(op.Tx, actual.Tx) && len(op.Rx) == len(actual.Rx) {
+			r.pos++
+			return
+		}
+	}
+	if actual.Kind == "read" || actual.Kind == "transfer" {
+		// the received bytes are unknown, show the length only
+		actual.Rx = make([]byte, len(actual.Rx))
+	}
+	r.err = &Divergence{Index: r.pos, Expected: expected, Actual: actual.String()}
+	err = r.err
+	return
+}
+
+func (r *Replayer) Transfer(buf []byte) (err error) {
+	op, err := r.next(Op{Kind: "transfer", Tx: buf, Rx: buf})
+	if err != nil {
+		return
+	}
+	copy(buf, op.Rx)
+	return
+}
+
+func (r *Replayer) Write(buf []byte) (err error) {
+	_, err = r.next(Op{Kind: "write", Tx: buf})
+	return
+}
+
+func (r *Replayer) Read(buf []byte) (err error) {
+	op, err := r.next(Op{Kind: "read", Rx: buf})
+	if err != nil {
+		return
+	}
+	copy(buf, op.Rx)
+	return
+}
+
+func (r *Replayer) Close() error {
+	return nil
+}
+
+// Done returns the first divergence, or an error if the driver stopped
+// before the end of the session
+func (r *Replayer) Done() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.err != nil {
+		err = r.err
+		return
+	}
+	if r.pos < len(r.ops) {
+		err = errors.New(fmt.Sprintf("%d of %d operations replayed, next %q", r.pos, len(r.ops), r.ops[r.pos].String()))
+	}
+	return
+}
+
+// replayedPin checks the level changes against the session. Only Set, Clear
+// and Close are supported.
+type replayedPin struct {
+	gpio.Pin
+	name string
+	r    *Replayer
+}
+
+func (p *replayedPin) Set() {
+	p.r.next(Op{Kind: "pin", Pin: p.name, Level: true})
+}
+
+func (p *replayedPin) Clear() {
+	p.r.next(Op{Kind: "pin", Pin: p.name, Level: false})
+}
+
+func (p *replayedPin) Close() error {
+	return nil
+}
+
+// Pin returns a fake output pin checked against the session
+func (r *Replayer) Pin(name string) gpio.Pin {
+	return &replayedPin{name: name, r: r}
+}
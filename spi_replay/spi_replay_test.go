@@ -0,0 +1,116 @@
+package spi_replay
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/jdevelop/gpio"
+	"github.com/stretchr/testify/assert"
+)
+
+// echoBus answers every transfer with the bytes sent plus one
+type echoBus struct {
+	written [][]byte
+}
+
+func (b *echoBus) Transfer(buf []byte) error {
+	for i := range buf {
+		buf[i]++
+	}
+	return nil
+}
+
+func (b *echoBus) Write(buf []byte) error {
+	b.written = append(b.written, append([]byte{}, buf...))
+	return nil
+}
+
+func (b *echoBus) Read(buf []byte) error {
+	for i := range buf {
+		buf[i] = byte(i)
+	}
+	return nil
+}
+
+func (b *echoBus) Close() error {
+	return nil
+}
+
+type outputPin struct {
+	gpio.Pin
+	level bool
+}
+
+func (p *outputPin) Set()   { p.level = true }
+func (p *outputPin) Clear() { p.level = false }
+
+func session(conn Conn, dc gpio.Pin) {
+	buf := []byte{0x01, 0x02}
+	conn.Transfer(buf)
+	dc.Clear()
+	conn.Write([]byte{0xAE, 0xD5})
+	dc.Set()
+	conn.Read(make([]byte, 3))
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	var out bytes.Buffer
+	bus := &echoBus{}
+	pin := &outputPin{}
+	rec := NewRecorder(bus, &out)
+	rec.Comment("test session")
+	session(rec, rec.Pin("dc", pin))
+	assert.True(t, pin.level)
+	assert.Equal(t, [][]byte{{0xAE, 0xD5}}, bus.written)
+	assert.Equal(t, "# test session\ntransfer 0102 0203\npin dc 0\nwrite AED5\npin dc 1\nread 000102\n", out.String())
+
+	ops, err := ParseSession(&out)
+	assert.NoError(t, err)
+	r := NewReplayer(ops)
+	buf := []byte{0x01, 0x02}
+	assert.NoError(t, r.Transfer(buf))
+	assert.Equal(t, []byte{0x02, 0x03}, buf)
+	dc := r.Pin("dc")
+	dc.Clear()
+	assert.NoError(t, r.Write([]byte{0xAE, 0xD5}))
+	dc.Set()
+	assert.Error(t, r.Done(), "the read is missing")
+	read := make([]byte, 3)
+	assert.NoError(t, r.Read(read))
+	assert.Equal(t, []byte{0, 1, 2}, read)
+	assert.NoError(t, r.Done())
+	assert.Error(t, r.Write([]byte{0x00}), "beyond the end of the session")
+}
+
+func TestDivergence(t *testing.T) {
+	ops, err := ParseSession(bytes.NewBufferString("write AED5\npin dc 1\nwrite 00\n"))
+	assert.NoError(t, err)
+	r := NewReplayer(ops)
+	err = r.Write([]byte{0xAE, 0xD4})
+	if assert.IsType(t, &Divergence{}, err) {
+		d := err.(*Divergence)
+		assert.Equal(t, 0, d.Index)
+		assert.Equal(t, "write AED5", d.Expected)
+		assert.Equal(t, "write AED4", d.Actual)
+	}
+	assert.Equal(t, err, r.Write([]byte{0xAE, 0xD5}), "divergence is sticky")
+	assert.Equal(t, err, r.Done())
+
+	r = NewReplayer(ops)
+	assert.NoError(t, r.Write([]byte{0xAE, 0xD5}))
+	r.Pin("dc").Clear()
+	assert.Error(t, r.Done())
+}
+
+func TestParseSession(t *testing.T) {
+	for _, bad := range []string{
+		"transfer 00",
+		"transfer 0011 00",
+		"write XY",
+		"pin dc 2",
+		"erase 00",
+	} {
+		_, err := ParseSession(bytes.NewBufferString(bad))
+		assert.Error(t, err, bad)
+	}
+}
@@ -11,8 +11,13 @@ import (
 	"time"
 )
 
+// Conn is the part of *spi.Device the display uses
+type Conn interface {
+	Write(buf []byte) error
+}
+
 type SSD1306 struct {
-	spiDev               *spi.Device
+	spiDev               Conn
 	Width, Height, Pages uint
 	reset, dc            gpio.Pin
 	buffer               []byte
@@ -61,32 +66,52 @@ func MakeSSD1306(funcs ...Setup) (display *SSD1306, err error) {
 	spiDev.SetLSBFirst(false)
 	spiDev.SetBitsPerWord(8)
 
+	reset, err := gpio.OpenPin(int(ssd.ResetPin), gpio.ModeOutput)
+	if err != nil {
+		spiDev.Close()
+		return
+	}
+
+	dc, err := gpio.OpenPin(int(ssd.DcPin), gpio.ModeOutput)
+	if err != nil {
+		reset.Close()
+		spiDev.Close()
+		return
+	}
+
+	display = newSSD1306(spiDev, reset, dc, ssd)
+	return
+}
+
+// NewSSD1306 creates the display on top of an already opened bus and pins,
+// e.g. a recorded session. Bus and pin numbers in the setup are ignored.
+func NewSSD1306(conn Conn, reset, dc gpio.Pin, funcs ...Setup) *SSD1306 {
+	ssd := defaultSetup()
+	for _, s := range funcs {
+		s(ssd)
+	}
+	return newSSD1306(conn, reset, dc, ssd)
+}
+
+func newSSD1306(conn Conn, reset, dc gpio.Pin, ssd *SSD1306Setup) *SSD1306 {
 	dsp := SSD1306{
 		Height: ssd.Height,
 		Width:  ssd.Width,
 	}
 
-	display = &dsp
-
 	dsp.Pages = dsp.Height / 8
 
 	dsp.buffer = make([]byte, dsp.Width*dsp.Pages)
 
-	dsp.spiDev = spiDev
+	dsp.spiDev = conn
 
 	dsp.cmd = make([]byte, 1)
 
-	dsp.reset, err = gpio.OpenPin(int(ssd.ResetPin), gpio.ModeOutput)
-	if err != nil {
-		return
-	}
+	dsp.reset = reset
 
-	dsp.dc, err = gpio.OpenPin(int(ssd.DcPin), gpio.ModeOutput)
-	if err != nil {
-		return
-	}
+	dsp.dc = dc
 
-	return
+	return &dsp
 }
 
 func (s *SSD1306) Command(cmd byte) (err error) {
@@ -0,0 +1,57 @@
+package oled_spi
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/jdevelop/golang-rpi-extras/spi_replay"
+	"github.com/jdevelop/gpio"
+	"github.com/stretchr/testify/assert"
+)
+
+var record = flag.Bool("record", false, "record the sessions in testdata")
+
+// sink accepts every write, it stands for the display while recording
+type sink struct{}
+
+func (sink) Transfer(buf []byte) error { return nil }
+func (sink) Write(buf []byte) error    { return nil }
+func (sink) Read(buf []byte) error     { return nil }
+func (sink) Close() error              { return nil }
+
+type outputPin struct {
+	gpio.Pin
+}
+
+func (outputPin) Set()   {}
+func (outputPin) Clear() {}
+
+func startSession(t *testing.T, conn spi_replay.Conn, reset, dc gpio.Pin) {
+	display := NewSSD1306(conn, reset, dc, Width(128), Height(64))
+	assert.NoError(t, display.Start())
+	display.buffer[0] = 0xFF
+	assert.NoError(t, display.Refresh())
+	assert.NoError(t, display.Contrast(0x40))
+}
+
+func TestReplayStart(t *testing.T) {
+	const session = "testdata/start.spi"
+	if *record {
+		f, err := os.Create(session)
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer f.Close()
+		rec := spi_replay.NewRecorder(sink{}, f)
+		rec.Comment("start a 128x64 display, refresh and set the contrast")
+		startSession(t, rec, rec.Pin("reset", outputPin{}), rec.Pin("dc", outputPin{}))
+		return
+	}
+	replay, err := spi_replay.LoadReplayer(session)
+	if !assert.NoError(t, err) {
+		return
+	}
+	startSession(t, replay, replay.Pin("reset"), replay.Pin("dc"))
+	assert.NoError(t, replay.Done())
+}
@@ -0,0 +1,177 @@
+package wedge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522"
+	"github.com/sirupsen/logrus"
+)
+
+// Format is the way the UID is typed
+type Format int
+
+const (
+	// Hex types two upper case hex digits per byte
+	Hex Format = iota
+	// Decimal types the UID as a single unsigned number
+	Decimal
+)
+
+// input event types and codes, linux/input-event-codes.h
+const (
+	evSyn     = 0x00
+	evKey     = 0x01
+	synReport = 0
+
+	keyEnter     = 28
+	keyLeftShift = 42
+)
+
+// keys maps the characters to the key codes of the US layout
+var keys = map[rune]uint16{
+	'1': 2, '2': 3, '3': 4, '4': 5, '5': 6, '6': 7, '7': 8, '8': 9, '9': 10, '0': 11,
+	'-': 12, '\t': 15, '\n': keyEnter, ' ': 57, ';': 39,
+	'q': 16, 'w': 17, 'e': 18, 'r': 19, 't': 20, 'y': 21, 'u': 22, 'i': 23, 'o': 24, 'p': 25,
+	'a': 30, 's': 31, 'd': 32, 'f': 33, 'g': 34, 'h': 35, 'j': 36, 'k': 37, 'l': 38,
+	'z': 44, 'x': 45, 'c': 46, 'v': 47, 'b': 48, 'n': 49, 'm': 50,
+}
+
+// shifted are the characters typed with the shift key held
+var shifted = map[rune]rune{':': ';', '_': '-'}
+
+func keyFor(c rune) (code uint16, shift bool, ok bool) {
+	if base, found := shifted[c]; found {
+		c, shift = base, true
+	} else if c >= 'A' && c <= 'Z' {
+		c, shift = c-'A'+'a', true
+	}
+	code, ok = keys[c]
+	return
+}
+
+// inputEvent is struct input_event, the size of the time stamp depends on
+// the platform
+type inputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+// FormatUID renders the UID as the keyboard types it. Reverse starts with
+// the last byte received from the card, as many wedge readers do.
+func FormatUID(uid []byte, f Format, reverse bool) string {
+	data := append([]byte{}, uid...)
+	if reverse {
+		for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+			data[i], data[j] = data[j], data[i]
+		}
+	}
+	if f == Decimal {
+		return new(big.Int).SetBytes(data).String()
+	}
+	return strings.ToUpper(fmt.Sprintf("%x", data))
+}
+
+// Keyboard is a virtual keyboard the UIDs are typed on
+type Keyboard struct {
+	Format  Format
+	Reverse bool
+	Enter   bool          // press Enter after the UID
+	Delay   time.Duration // between the key strokes
+	dev     io.WriteCloser
+	mu      sync.Mutex
+}
+
+func newKeyboard(dev io.WriteCloser) *Keyboard {
+	return &Keyboard{
+		Format: Hex,
+		Enter:  true,
+		Delay:  5 * time.Millisecond,
+		dev:    dev,
+	}
+}
+
+func (k *Keyboard) emit(events ...inputEvent) (err error) {
+	var buf bytes.Buffer
+	for _, e := range events {
+		binary.Write(&buf, binary.LittleEndian, &e)
+	}
+	_, err = k.dev.Write(buf.Bytes())
+	return
+}
+
+func (k *Keyboard) key(code uint16, pressed bool) inputEvent {
+	var value int32
+	if pressed {
+		value = 1
+	}
+	return inputEvent{Type: evKey, Code: code, Value: value}
+}
+
+var syn = inputEvent{Type: evSyn, Code: synReport}
+
+// Type types the text, only the characters of the US layout letters, digits
+// and a few punctuation marks are supported
+func (k *Keyboard) Type(text string) (err error) {
+	for _, c := range text {
+		if _, _, ok := keyFor(c); !ok {
+			err = errors.New(fmt.Sprintf("no key for %q", c))
+			return
+		}
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, c := range text {
+		code, shift, _ := keyFor(c)
+		var events []inputEvent
+		if shift {
+			events = append(events, k.key(keyLeftShift, true))
+		}
+		events = append(events, k.key(code, true), syn, k.key(code, false))
+		if shift {
+			events = append(events, k.key(keyLeftShift, false))
+		}
+		events = append(events, syn)
+		if err = k.emit(events...); err != nil {
+			return
+		}
+		time.Sleep(k.Delay)
+	}
+	return
+}
+
+// TypeUID types the UID in the configured format
+func (k *Keyboard) TypeUID(uid []byte) (err error) {
+	text := FormatUID(uid, k.Format, k.Reverse)
+	if k.Enter {
+		text += "\n"
+	}
+	err = k.Type(text)
+	return
+}
+
+func (k *Keyboard) Close() error {
+	return k.dev.Close()
+}
+
+// Forward waits for the cards on the reader and types the UID of every
+// card. The same card is ignored until it has been out of the field for
+// the hold-off time. Forward returns when the reader is closed.
+func Forward(r rf522.CardReader, k *Keyboard, holdOff time.Duration) error {
+	return rf522.Cards(r, holdOff, func(uid []byte) error {
+		if err := k.TypeUID(uid); err != nil {
+			logrus.Warn("Can not type UID ", err)
+		}
+		return nil
+	})
+}
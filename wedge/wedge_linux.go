@@ -0,0 +1,102 @@
+package wedge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"syscall"
+	"time"
+)
+
+// uinput ioctls, linux/uinput.h
+const (
+	uiSetEvBit   = 0x40045564
+	uiSetKeyBit  = 0x40045565
+	uiDevCreate  = 0x5501
+	uiDevDestroy = 0x5502
+)
+
+const busUSB = 0x03
+
+// uinputUserDev is struct uinput_user_dev of the legacy setup interface,
+// which works on every kernel the Raspberry Pi runs
+type uinputUserDev struct {
+	Name         [80]byte
+	BusType      uint16
+	Vendor       uint16
+	Product      uint16
+	Version      uint16
+	FFEffectsMax uint32
+	AbsMax       [64]int32
+	AbsMin       [64]int32
+	AbsFuzz      [64]int32
+	AbsFlat      [64]int32
+}
+
+type uinputDevice struct {
+	f *os.File
+}
+
+func (d *uinputDevice) ioctl(req, arg uintptr) (err error) {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, d.f.Fd(), req, arg)
+	if errno != 0 {
+		err = errno
+	}
+	return
+}
+
+func (d *uinputDevice) Write(data []byte) (int, error) {
+	return d.f.Write(data)
+}
+
+func (d *uinputDevice) Close() (err error) {
+	err = d.ioctl(uiDevDestroy, 0)
+	if err1 := d.f.Close(); err == nil {
+		err = err1
+	}
+	return
+}
+
+// NewKeyboard creates the virtual keyboard through /dev/uinput, which needs
+// root or a udev rule granting access to the device
+func NewKeyboard(name string) (k *Keyboard, err error) {
+	f, err := os.OpenFile("/dev/uinput", os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return
+	}
+	d := &uinputDevice{f: f}
+	defer func() {
+		if err != nil {
+			f.Close()
+		}
+	}()
+	if err = d.ioctl(uiSetEvBit, evKey); err != nil {
+		return
+	}
+	if err = d.ioctl(uiSetEvBit, evSyn); err != nil {
+		return
+	}
+	for _, code := range keys {
+		if err = d.ioctl(uiSetKeyBit, uintptr(code)); err != nil {
+			return
+		}
+	}
+	if err = d.ioctl(uiSetKeyBit, keyLeftShift); err != nil {
+		return
+	}
+	dev := uinputUserDev{BusType: busUSB, Vendor: 0x1234, Product: 0x5678, Version: 1}
+	copy(dev.Name[:len(dev.Name)-1], name)
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, &dev)
+	if _, err = f.Write(buf.Bytes()); err != nil {
+		return
+	}
+	if err = d.ioctl(uiDevCreate, 0); err != nil {
+		return
+	}
+	// give udev and the display server time to pick up the new device,
+	// the first key strokes are lost otherwise
+	time.Sleep(time.Second)
+	k = newKeyboard(d)
+	return
+}
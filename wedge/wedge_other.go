@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package wedge
+
+import "errors"
+
+func NewKeyboard(name string) (k *Keyboard, err error) {
+	err = errors.New("uinput is only supported on Linux")
+	return
+}
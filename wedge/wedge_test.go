@@ -0,0 +1,77 @@
+package wedge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type bufferDevice struct {
+	bytes.Buffer
+}
+
+func (d *bufferDevice) Close() error {
+	return nil
+}
+
+// strokes decodes the events into "+code" / "-code" for the key presses and
+// releases, dropping the sync events
+func strokes(t *testing.T, data []byte) (res []string) {
+	r := bytes.NewReader(data)
+	for r.Len() > 0 {
+		var e inputEvent
+		assert.NoError(t, binary.Read(r, binary.LittleEndian, &e))
+		switch {
+		case e.Type == evSyn:
+		case e.Value == 1:
+			res = append(res, "+"+keyName(e.Code))
+		default:
+			res = append(res, "-"+keyName(e.Code))
+		}
+	}
+	return
+}
+
+func keyName(code uint16) string {
+	if code == keyLeftShift {
+		return "shift"
+	}
+	for c, k := range keys {
+		if k == code {
+			return string(c)
+		}
+	}
+	return "?"
+}
+
+func TestFormatUID(t *testing.T) {
+	uid := []byte{0xDE, 0xAD, 0xBE, 0xEF}
+	assert.Equal(t, "DEADBEEF", FormatUID(uid, Hex, false))
+	assert.Equal(t, "EFBEADDE", FormatUID(uid, Hex, true))
+	assert.Equal(t, "3735928559", FormatUID(uid, Decimal, false))
+	assert.Equal(t, "4022250974", FormatUID(uid, Decimal, true))
+	assert.Equal(t, "4886718379", FormatUID([]byte{0x01, 0x23, 0x45, 0x67, 0xAB}, Decimal, false))
+}
+
+func TestTypeUID(t *testing.T) {
+	dev := new(bufferDevice)
+	k := newKeyboard(dev)
+	k.Delay = 0
+	assert.NoError(t, k.TypeUID([]byte{0x1A}))
+	assert.Equal(t, []string{"+1", "-1", "+shift", "+a", "-a", "-shift", "+\n", "-\n"}, strokes(t, dev.Bytes()))
+
+	dev.Reset()
+	k.Format = Decimal
+	k.Enter = false
+	assert.NoError(t, k.TypeUID([]byte{0x01, 0x00}))
+	assert.Equal(t, []string{"+2", "-2", "+5", "-5", "+6", "-6"}, strokes(t, dev.Bytes()))
+}
+
+func TestTypeUnknownCharacter(t *testing.T) {
+	dev := new(bufferDevice)
+	k := newKeyboard(dev)
+	assert.Error(t, k.Type("ab€"))
+	assert.Equal(t, 0, dev.Len(), "nothing is typed")
+}
@@ -0,0 +1,198 @@
+package wiegand
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jdevelop/golang-rpi-extras/rf522"
+	"github.com/jdevelop/gpio"
+	rpio "github.com/jdevelop/gpio/rpi"
+	"github.com/sirupsen/logrus"
+)
+
+// Format is the frame length in bits, including the two parity bits
+type Format int
+
+const (
+	// Wiegand26 carries an 8 bit facility code and a 16 bit card number
+	Wiegand26 Format = 26
+	// Wiegand34 carries a 16 bit facility code and a 16 bit card number
+	Wiegand34 Format = 34
+)
+
+func (f Format) facilityBits() uint {
+	if f == Wiegand34 {
+		return 16
+	}
+	return 8
+}
+
+const cardBits = 16
+
+// Encode builds the frame, most significant bit first: the even parity of
+// the first half of the data bits, the facility code, the card number and the
+// odd parity of the second half of the data bits
+func Encode(f Format, facility, card uint32) (bits []bool, err error) {
+	if f != Wiegand26 && f != Wiegand34 {
+		err = errors.New(fmt.Sprintf("unsupported format %d", f))
+		return
+	}
+	fBits := f.facilityBits()
+	if facility >= 1<<fBits || card >= 1<<cardBits {
+		err = errors.New(fmt.Sprintf("facility %d / card %d don't fit into %d bit format", facility, card, f))
+		return
+	}
+	data := uint64(facility)<<cardBits | uint64(card)
+	dataBits := int(fBits + cardBits)
+	bits = make([]bool, dataBits+2)
+	for i := 0; i < dataBits; i++ {
+		bits[i+1] = data&(1<<uint(dataBits-1-i)) != 0
+	}
+	half := dataBits / 2
+	even, odd := false, true
+	for i := 1; i <= half; i++ {
+		even = even != bits[i]
+	}
+	for i := half + 1; i <= dataBits; i++ {
+		odd = odd != bits[i]
+	}
+	bits[0] = even
+	bits[dataBits+1] = odd
+	return
+}
+
+// Extractor maps the card UID to the facility code and the card number
+type Extractor func(uid []byte) (facility, card uint32)
+
+func uidValue(uid []byte, reverse bool) (v uint64) {
+	for i := range uid {
+		b := uid[i]
+		if reverse {
+			b = uid[len(uid)-1-i]
+		}
+		v = v<<8 | uint64(b)
+	}
+	return
+}
+
+// Truncate reads the UID as a big endian number, the first byte received
+// from the card being the most significant one (or the least significant one
+// if reverse is set), and keeps as many low bits as the format carries
+func Truncate(f Format, reverse bool) Extractor {
+	fBits := f.facilityBits()
+	return func(uid []byte) (facility, card uint32) {
+		v := uidValue(uid, reverse)
+		card = uint32(v & (1<<cardBits - 1))
+		facility = uint32((v >> cardBits) & (1<<fBits - 1))
+		return
+	}
+}
+
+// FixedFacility sends the same facility code for every card, the card
+// number is taken from the lowest 16 bits of the UID
+func FixedFacility(facility uint32, reverse bool) Extractor {
+	return func(uid []byte) (uint32, uint32) {
+		return facility, uint32(uidValue(uid, reverse) & (1<<cardBits - 1))
+	}
+}
+
+// Wiegand drives the D0 and D1 lines of an access control panel input.
+// Both lines idle high, a zero bit is a low pulse on D0 and a one bit is a
+// low pulse on D1.
+type Wiegand struct {
+	PulseWidth    time.Duration
+	PulseInterval time.Duration
+	Format        Format
+	Extract       Extractor
+	d0, d1        gpio.Pin
+	mu            sync.Mutex
+}
+
+// NewWiegand opens the D0 and D1 pins (BCM numbering). The facility code
+// and the card number are extracted from the UID with Truncate.
+func NewWiegand(d0Pin, d1Pin int, f Format) (w *Wiegand, err error) {
+	if f != Wiegand26 && f != Wiegand34 {
+		err = errors.New(fmt.Sprintf("unsupported format %d", f))
+		return
+	}
+	d0, err := rpio.OpenPin(d0Pin, gpio.ModeOutput)
+	if err != nil {
+		return
+	}
+	d1, err := rpio.OpenPin(d1Pin, gpio.ModeOutput)
+	if err != nil {
+		d0.Close()
+		return
+	}
+	d0.Set()
+	d1.Set()
+	w = &Wiegand{
+		PulseWidth:    50 * time.Microsecond,
+		PulseInterval: 2 * time.Millisecond,
+		Format:        f,
+		Extract:       Truncate(f, false),
+		d0:            d0,
+		d1:            d1,
+	}
+	return
+}
+
+func (w *Wiegand) pulse(pin gpio.Pin) {
+	pin.Clear()
+	// sleep is too coarse for tens of microseconds
+	for start := time.Now(); time.Since(start) < w.PulseWidth; {
+	}
+	pin.Set()
+}
+
+// SendBits sends a raw frame, most significant bit first
+func (w *Wiegand) SendBits(bits []bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for _, b := range bits {
+		if b {
+			w.pulse(w.d1)
+		} else {
+			w.pulse(w.d0)
+		}
+		time.Sleep(w.PulseInterval - w.PulseWidth)
+	}
+}
+
+func (w *Wiegand) Send(facility, card uint32) (err error) {
+	bits, err := Encode(w.Format, facility, card)
+	if err != nil {
+		return
+	}
+	w.SendBits(bits)
+	return
+}
+
+func (w *Wiegand) SendUID(uid []byte) (err error) {
+	facility, card := w.Extract(uid)
+	err = w.Send(facility, card)
+	return
+}
+
+func (w *Wiegand) Close() (err error) {
+	err = w.d0.Close()
+	if err1 := w.d1.Close(); err == nil {
+		err = err1
+	}
+	return
+}
+
+// Forward waits for the cards on the reader and sends the UID of every card
+// to the panel. The reader restarts the field on every wait, so the same
+// card is ignored until it has been out of the field for the hold-off time.
+// Forward returns when the reader is closed.
+func Forward(r rf522.CardReader, w *Wiegand, holdOff time.Duration) error {
+	return rf522.Cards(r, holdOff, func(uid []byte) error {
+		if err := w.SendUID(uid); err != nil {
+			logrus.Warn("Can not send UID ", err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,180 @@
+package wiegand
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jdevelop/gpio"
+	"github.com/stretchr/testify/assert"
+)
+
+func bitString(bits []bool) string {
+	var s strings.Builder
+	for _, b := range bits {
+		if b {
+			s.WriteByte('1')
+		} else {
+			s.WriteByte('0')
+		}
+	}
+	return s.String()
+}
+
+func TestEncode26(t *testing.T) {
+	bits, err := Encode(Wiegand26, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "1"+"00000001"+"0000000000000001"+"0", bitString(bits))
+
+	bits, err = Encode(Wiegand26, 255, 65535)
+	assert.NoError(t, err)
+	assert.Equal(t, "0"+strings.Repeat("1", 24)+"1", bitString(bits))
+
+	_, err = Encode(Wiegand26, 256, 1)
+	assert.Error(t, err)
+}
+
+func TestEncode34(t *testing.T) {
+	bits, err := Encode(Wiegand34, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, "1"+"0000000000000001"+"0000000000000001"+"0", bitString(bits))
+
+	bits, err = Encode(Wiegand34, 0x8000, 0x0003)
+	assert.NoError(t, err)
+	assert.Equal(t, "1"+"1000000000000000"+"0000000000000011"+"1", bitString(bits))
+
+	_, err = Encode(Format(37), 1, 1)
+	assert.Error(t, err)
+}
+
+func TestExtractors(t *testing.T) {
+	uid := []byte{0xDE, 0xAD, 0xBE, 0xEF}
+
+	facility, card := Truncate(Wiegand26, false)(uid)
+	assert.Equal(t, uint32(0xAD), facility)
+	assert.Equal(t, uint32(0xBEEF), card)
+
+	facility, card = Truncate(Wiegand34, true)(uid)
+	assert.Equal(t, uint32(0xEFBE), facility)
+	assert.Equal(t, uint32(0xADDE), card)
+
+	facility, card = FixedFacility(42, false)(uid)
+	assert.Equal(t, uint32(42), facility)
+	assert.Equal(t, uint32(0xBEEF), card)
+}
+
+// edge is a level change of D0 or D1
+type edge struct {
+	line string
+	high bool
+	at   time.Time
+}
+
+type recorder struct {
+	mu    sync.Mutex
+	edges []edge
+}
+
+// line records the levels set on a fake D0 or D1 pin
+type line struct {
+	gpio.Pin
+	name string
+	rec  *recorder
+}
+
+func (l line) record(high bool) {
+	l.rec.mu.Lock()
+	l.rec.edges = append(l.rec.edges, edge{l.name, high, time.Now()})
+	l.rec.mu.Unlock()
+}
+
+func (l line) Set() {
+	l.record(true)
+}
+
+func (l line) Clear() {
+	l.record(false)
+}
+
+func newFakeWiegand(width, interval time.Duration) (w *Wiegand, rec *recorder) {
+	rec = new(recorder)
+	w = &Wiegand{
+		PulseWidth:    width,
+		PulseInterval: interval,
+		Format:        Wiegand26,
+		Extract:       Truncate(Wiegand26, false),
+		d0:            line{name: "D0", rec: rec},
+		d1:            line{name: "D1", rec: rec},
+	}
+	return
+}
+
+// received decodes the bits from the pulses, a low D0 is a zero and a low
+// D1 a one
+func (rec *recorder) received() string {
+	var bits []bool
+	for _, e := range rec.edges {
+		if !e.high {
+			bits = append(bits, e.line == "D1")
+		}
+	}
+	return bitString(bits)
+}
+
+func TestSendBits(t *testing.T) {
+	w, rec := newFakeWiegand(200*time.Microsecond, 2*time.Millisecond)
+	w.SendBits([]bool{false, true, true, false})
+
+	var levels []string
+	for _, e := range rec.edges {
+		level := "low"
+		if e.high {
+			level = "high"
+		}
+		levels = append(levels, e.line+" "+level)
+	}
+	assert.Equal(t, []string{
+		"D0 low", "D0 high", "D1 low", "D1 high", "D1 low", "D1 high", "D0 low", "D0 high",
+	}, levels, "a pulse per bit, back high after each one")
+
+	for i := 0; i < len(rec.edges); i += 2 {
+		width := rec.edges[i+1].at.Sub(rec.edges[i].at)
+		assert.True(t, width >= w.PulseWidth, "pulse %d is %v", i/2, width)
+		if i > 0 {
+			interval := rec.edges[i].at.Sub(rec.edges[i-2].at)
+			assert.True(t, interval >= w.PulseInterval, "interval before pulse %d is %v", i/2, interval)
+		}
+	}
+}
+
+// cards returns the UIDs one per wait, the reader is closed once they run
+// out
+type cards struct {
+	uids [][]byte
+}
+
+func (c *cards) Wait() error {
+	if len(c.uids) == 0 {
+		return errors.New("closed")
+	}
+	return nil
+}
+
+func (c *cards) ReadUID() (uid []byte, err error) {
+	uid, c.uids = c.uids[0], c.uids[1:]
+	return
+}
+
+func TestForward(t *testing.T) {
+	w, rec := newFakeWiegand(time.Microsecond, 10*time.Microsecond)
+	r := &cards{uids: [][]byte{{0xDE, 0xAD, 0xBE, 0xEF}, {0xDE, 0xAD, 0xBE, 0xEF}, {0x01, 0x02, 0x03, 0x04}}}
+
+	err := Forward(r, w, time.Hour)
+	assert.EqualError(t, err, "closed")
+
+	first, _ := Encode(Wiegand26, 0xAD, 0xBEEF)
+	second, _ := Encode(Wiegand26, 0x02, 0x0304)
+	assert.Equal(t, bitString(first)+bitString(second), rec.received(), "the card held in the field is sent once")
+}